@@ -0,0 +1,36 @@
+// Command resanitize runs the HTML sanitizer over the posts and comments that
+// are already stored. It reads the database settings from the same environment
+// variables as the server.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/billymosis/socialmedia-app/db"
+	pss "github.com/billymosis/socialmedia-app/store/post"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 500, "rows sanitized per transaction")
+	flag.Parse()
+
+	pool, err := db.Connection("postgres", os.Getenv("DB_HOST"), os.Getenv("DB_NAME"), os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_PORT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	posts := pss.NewPostStore(pool, validator.New(), nil)
+	changed, err := posts.Resanitize(context.Background(), *batchSize)
+	for table, n := range changed {
+		logrus.Infof("resanitized %d %s", n, table)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS friend_requests(
+    id SERIAL PRIMARY KEY,
+    sender_id INTEGER REFERENCES users(id) NOT NULL,
+    receiver_id INTEGER REFERENCES users(id) NOT NULL,
+    status VARCHAR(10) DEFAULT 'pending' NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    responded_at TIMESTAMP,
+    CONSTRAINT check_not_self_request CHECK (sender_id <> receiver_id),
+    CONSTRAINT check_request_status CHECK (status IN ('pending', 'accepted', 'rejected', 'cancelled'))
+);
+
+CREATE UNIQUE INDEX unique_pending_friend_request
+ON friend_requests (LEAST(sender_id, receiver_id), GREATEST(sender_id, receiver_id))
+WHERE status = 'pending';
+
+CREATE INDEX friend_requests_receiver ON friend_requests (receiver_id, status);
+CREATE INDEX friend_requests_sender ON friend_requests (sender_id, status);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS comments_post_id;
+DROP INDEX IF EXISTS posts_created_at_active;
+ALTER TABLE posts DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE posts DROP COLUMN IF EXISTS updated_at;
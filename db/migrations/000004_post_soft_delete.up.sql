@@ -0,0 +1,5 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX posts_created_at_active ON posts (created_at DESC) WHERE deleted_at IS NULL;
+CREATE INDEX comments_post_id ON comments (post_id);
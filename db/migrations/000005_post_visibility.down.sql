@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS relationships_second;
+DROP INDEX IF EXISTS posts_user_id;
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS check_post_visibility;
+ALTER TABLE posts DROP COLUMN IF EXISTS visibility;
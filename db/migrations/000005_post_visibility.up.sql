@@ -0,0 +1,5 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS visibility VARCHAR(10) DEFAULT 'public' NOT NULL;
+ALTER TABLE posts ADD CONSTRAINT check_post_visibility CHECK (visibility IN ('public', 'friends', 'private'));
+
+CREATE INDEX posts_user_id ON posts (user_id, created_at DESC) WHERE deleted_at IS NULL;
+CREATE INDEX relationships_second ON relationships (user_second_id, user_first_id);
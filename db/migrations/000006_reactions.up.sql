@@ -0,0 +1,21 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS reaction_counts JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS reaction_counts JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+CREATE TABLE IF NOT EXISTS post_reactions(
+    post_id INTEGER REFERENCES posts(id) NOT NULL,
+    user_id INTEGER REFERENCES users(id) NOT NULL,
+    kind VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS comment_reactions(
+    comment_id INTEGER REFERENCES comments(id) NOT NULL,
+    user_id INTEGER REFERENCES users(id) NOT NULL,
+    kind VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+CREATE INDEX post_reactions_user_id ON post_reactions (user_id);
+CREATE INDEX comment_reactions_user_id ON comment_reactions (user_id);
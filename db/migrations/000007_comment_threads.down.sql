@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS comments_post_created_at;
+DROP INDEX IF EXISTS comments_parent_comment_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS comment_count;
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_comment_id;
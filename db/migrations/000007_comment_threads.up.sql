@@ -0,0 +1,9 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS parent_comment_id INTEGER REFERENCES comments(id);
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS comment_count INTEGER DEFAULT 0 NOT NULL;
+
+UPDATE posts p SET comment_count = (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id);
+
+CREATE INDEX comments_parent_comment_id ON comments (parent_comment_id);
+CREATE INDEX comments_post_created_at ON comments (post_id, created_at DESC, id DESC) WHERE deleted_at IS NULL;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS notifications(
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    target_id INTEGER DEFAULT 0 NOT NULL,
+    last_actor_id INTEGER REFERENCES users(id) NOT NULL,
+    actor_count INTEGER DEFAULT 1 NOT NULL,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX unique_unread_notification_group
+ON notifications (user_id, type, target_id)
+WHERE read_at IS NULL;
+
+CREATE INDEX notifications_user_updated_at ON notifications (user_id, updated_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS notification_actors(
+    notification_id INTEGER REFERENCES notifications(id) ON DELETE CASCADE NOT NULL,
+    actor_id INTEGER REFERENCES users(id) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (notification_id, actor_id)
+);
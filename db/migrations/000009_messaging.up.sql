@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS conversations(
+    id SERIAL PRIMARY KEY,
+    -- Both ends of a one-to-one conversation, lowest id first, so that a pair of
+    -- users only ever gets one conversation.
+    direct_first_id INTEGER REFERENCES users(id),
+    direct_second_id INTEGER REFERENCES users(id),
+    last_message_id INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CHECK (direct_first_id < direct_second_id)
+);
+
+CREATE UNIQUE INDEX unique_direct_conversation
+ON conversations (direct_first_id, direct_second_id)
+WHERE direct_first_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS conversation_members(
+    conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE NOT NULL,
+    user_id INTEGER REFERENCES users(id) NOT NULL,
+    last_read_message_id INTEGER DEFAULT 0 NOT NULL,
+    last_read_at TIMESTAMP,
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX conversation_members_user_id ON conversation_members (user_id);
+
+CREATE TABLE IF NOT EXISTS messages(
+    id SERIAL PRIMARY KEY,
+    conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE NOT NULL,
+    sender_id INTEGER REFERENCES users(id) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX messages_conversation_created_at ON messages (conversation_id, created_at DESC, id DESC);
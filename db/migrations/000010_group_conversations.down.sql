@@ -0,0 +1,12 @@
+ALTER TABLE messages
+DROP COLUMN IF EXISTS target_user_id,
+DROP COLUMN IF EXISTS kind;
+
+ALTER TABLE conversation_members
+DROP COLUMN IF EXISTS muted_until,
+DROP COLUMN IF EXISTS role;
+
+ALTER TABLE conversations
+DROP COLUMN IF EXISTS avatar_url,
+DROP COLUMN IF EXISTS title,
+DROP COLUMN IF EXISTS is_group;
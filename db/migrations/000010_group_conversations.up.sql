@@ -0,0 +1,14 @@
+ALTER TABLE conversations
+ADD COLUMN is_group BOOLEAN DEFAULT FALSE NOT NULL,
+ADD COLUMN title VARCHAR(100),
+ADD COLUMN avatar_url TEXT;
+
+ALTER TABLE conversation_members
+ADD COLUMN role VARCHAR(10) DEFAULT 'member' NOT NULL,
+ADD COLUMN muted_until TIMESTAMP;
+
+-- System messages record membership changes; target_user_id is the member the
+-- change is about.
+ALTER TABLE messages
+ADD COLUMN kind VARCHAR(20) DEFAULT 'text' NOT NULL,
+ADD COLUMN target_user_id INTEGER REFERENCES users(id);
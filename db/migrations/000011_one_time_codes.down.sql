@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS one_time_codes;
+ALTER TABLE user_credentials DROP COLUMN IF EXISTS verified_at;
@@ -0,0 +1,14 @@
+ALTER TABLE user_credentials ADD COLUMN verified_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS one_time_codes(
+    id SERIAL PRIMARY KEY,
+    credential_id INTEGER REFERENCES user_credentials(id) ON DELETE CASCADE NOT NULL,
+    purpose VARCHAR(20) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    attempts INTEGER DEFAULT 0 NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX one_time_codes_credential ON one_time_codes (credential_id, purpose, created_at DESC);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS user_blocks(
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    target_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, target_id),
+    CONSTRAINT check_not_self_block CHECK (user_id <> target_id)
+);
+
+CREATE INDEX user_blocks_target_id ON user_blocks (target_id);
+
+CREATE TABLE IF NOT EXISTS user_mutes(
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    target_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, target_id),
+    CONSTRAINT check_not_self_mute CHECK (user_id <> target_id)
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS unique_user_handle;
+ALTER TABLE users DROP COLUMN IF EXISTS location;
+ALTER TABLE users DROP COLUMN IF EXISTS website;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
+ALTER TABLE users DROP COLUMN IF EXISTS handle_changed_at;
+ALTER TABLE users DROP COLUMN IF EXISTS handle;
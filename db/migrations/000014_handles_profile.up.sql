@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS handle VARCHAR(30);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS handle_changed_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio VARCHAR(160) DEFAULT '' NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS website VARCHAR(255) DEFAULT '' NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS location VARCHAR(50) DEFAULT '' NOT NULL;
+
+-- Handles are unique regardless of case but keep the case they were chosen in.
+CREATE UNIQUE INDEX unique_user_handle ON users (LOWER(handle));
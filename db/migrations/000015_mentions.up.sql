@@ -0,0 +1,12 @@
+-- Mentions in a post have no comment_id, mentions in one of its comments do.
+CREATE TABLE IF NOT EXISTS post_mentions(
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER REFERENCES posts(id) ON DELETE CASCADE NOT NULL,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX unique_post_mention ON post_mentions (post_id, user_id) WHERE comment_id IS NULL;
+CREATE UNIQUE INDEX unique_comment_mention ON post_mentions (comment_id, user_id) WHERE comment_id IS NOT NULL;
+CREATE INDEX post_mentions_user_id ON post_mentions (user_id, created_at DESC);
@@ -0,0 +1,10 @@
+-- search_text is the text of a post without markup, kept up to date by the
+-- application. The regexp below is only a first approximation for existing
+-- posts; running cmd/resanitize rewrites it properly.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_text TEXT DEFAULT '' NOT NULL;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', search_text)) STORED;
+
+UPDATE posts SET search_text = TRIM(regexp_replace(regexp_replace(html, '<[^>]*>', ' ', 'g'), '\s+', ' ', 'g'));
+
+CREATE INDEX IF NOT EXISTS posts_search_vector ON posts USING GIN (search_vector);
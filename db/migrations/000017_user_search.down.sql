@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS user_credentials_lower_value;
+DROP INDEX IF EXISTS users_handle_trgm;
+DROP INDEX IF EXISTS users_name_trgm;
+ALTER TABLE users DROP COLUMN IF EXISTS discoverable_by_phone;
+ALTER TABLE users DROP COLUMN IF EXISTS discoverable_by_email;
@@ -0,0 +1,8 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS discoverable_by_email BOOLEAN DEFAULT FALSE NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS discoverable_by_phone BOOLEAN DEFAULT FALSE NOT NULL;
+
+CREATE INDEX IF NOT EXISTS users_name_trgm ON users USING GIN (LOWER(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_handle_trgm ON users USING GIN (LOWER(handle) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS user_credentials_lower_value ON user_credentials (LOWER(credential_value));
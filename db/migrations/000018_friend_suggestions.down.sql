@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS friend_suggestion_dismissals;
+DROP TABLE IF EXISTS friend_suggestions;
@@ -0,0 +1,21 @@
+-- friend_suggestions is rebuilt by a background job, see
+-- RelationshipStore.RefreshSuggestions.
+CREATE TABLE IF NOT EXISTS friend_suggestions(
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    suggested_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    mutual_friends INTEGER NOT NULL,
+    shared_tags INTEGER NOT NULL,
+    score REAL NOT NULL,
+    computed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, suggested_id)
+);
+
+CREATE INDEX friend_suggestions_rank ON friend_suggestions (user_id, score DESC, suggested_id);
+
+CREATE TABLE IF NOT EXISTS friend_suggestion_dismissals(
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    target_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, target_id),
+    CONSTRAINT check_not_self_dismissal CHECK (user_id <> target_id)
+);
@@ -0,0 +1,19 @@
+-- A follow is pending while the followed user, who asked for followers to be
+-- approved, has not accepted it yet. Only accepted follows are counted.
+CREATE TABLE IF NOT EXISTS follows(
+    follower_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    followee_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    status VARCHAR(10) DEFAULT 'accepted' NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    PRIMARY KEY (follower_id, followee_id),
+    CONSTRAINT check_not_self_follow CHECK (follower_id <> followee_id),
+    CONSTRAINT check_follow_status CHECK (status IN ('pending', 'accepted'))
+);
+
+CREATE INDEX follows_followee ON follows (followee_id, status, created_at DESC);
+CREATE INDEX follows_follower ON follows (follower_id, status, created_at DESC);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS follower_count INTEGER DEFAULT 0 NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS following_count INTEGER DEFAULT 0 NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS followers_need_approval BOOLEAN DEFAULT FALSE NOT NULL;
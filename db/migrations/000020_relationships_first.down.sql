@@ -0,0 +1 @@
+DROP INDEX IF EXISTS relationships_first;
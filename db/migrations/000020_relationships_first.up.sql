@@ -0,0 +1,3 @@
+-- Lets RelationshipStore.RefreshSuggestions look up the friends of a batch of
+-- users, and of their friends, without scanning every relationship.
+CREATE INDEX IF NOT EXISTS relationships_first ON relationships (user_first_id, user_second_id);
@@ -3,14 +3,22 @@ package api
 import (
 	"net/http"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/billymosis/socialmedia-app/handler/api/conversation"
+	"github.com/billymosis/socialmedia-app/handler/api/notification"
 	x "github.com/billymosis/socialmedia-app/handler/api/post"
 	"github.com/billymosis/socialmedia-app/handler/api/relationship"
+	"github.com/billymosis/socialmedia-app/handler/api/stream"
 	"github.com/billymosis/socialmedia-app/handler/api/user"
 	AppMiddleware "github.com/billymosis/socialmedia-app/middleware"
 	"github.com/billymosis/socialmedia-app/service/image"
+	"github.com/billymosis/socialmedia-app/service/ratelimit"
+	"github.com/billymosis/socialmedia-app/service/realtime"
+	"github.com/billymosis/socialmedia-app/service/sender"
+	cs "github.com/billymosis/socialmedia-app/store/conversation"
+	ns "github.com/billymosis/socialmedia-app/store/notification"
 	pss "github.com/billymosis/socialmedia-app/store/post"
 	rs "github.com/billymosis/socialmedia-app/store/relationship"
+	ss "github.com/billymosis/socialmedia-app/store/session"
 	us "github.com/billymosis/socialmedia-app/store/user"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -23,15 +31,27 @@ type Server struct {
 	Users         *us.UserStore
 	Relationships *rs.RelationshipStore
 	Posts         *pss.PostStore
-	S3Client      *s3.Client
+	Sessions      *ss.SessionStore
+	Notifications *ns.NotificationStore
+	Conversations *cs.ConversationStore
+	Blobs         image.BlobStore
+	Events        *realtime.Hub
+	Sender        sender.Sender
+	Limiter       ratelimit.Store
 }
 
-func New(users *us.UserStore, relationships *rs.RelationshipStore, posts *pss.PostStore, s3client *s3.Client) Server {
+func New(users *us.UserStore, relationships *rs.RelationshipStore, posts *pss.PostStore, sessions *ss.SessionStore, notifications *ns.NotificationStore, conversations *cs.ConversationStore, blobs image.BlobStore, events *realtime.Hub, sender sender.Sender, limiter ratelimit.Store) Server {
 	return Server{
 		Users:         users,
 		Relationships: relationships,
 		Posts:         posts,
-		S3Client:      s3client,
+		Sessions:      sessions,
+		Notifications: notifications,
+		Conversations: conversations,
+		Blobs:         blobs,
+		Events:        events,
+		Sender:        sender,
+		Limiter:       limiter,
 	}
 }
 func prometheusHandler() http.Handler {
@@ -45,42 +65,154 @@ func prometheusHandler() http.Handler {
 }
 
 func (s Server) Handler() http.Handler {
+	validateJWT := AppMiddleware.ValidateJWT(s.Sessions)
+	limit := func(name string, rate ratelimit.Rate, key AppMiddleware.KeyFunc) func(http.Handler) http.Handler {
+		return AppMiddleware.RateLimit(s.Limiter, name, rate, key)
+	}
+	lockout := ratelimit.NewLockout(s.Limiter)
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	// The stream takes its token from the query, which must not be logged.
+	r.Use(AppMiddleware.TokenFromQuery("/v1/stream"), middleware.Logger)
 	r.Handle("/metrics", promhttp.Handler())
 
 	r.Route("/v1", func(r chi.Router) {
 		r.Use(AppMiddleware.WrapWithPrometheus)
 
 		r.Route("/user", func(r chi.Router) {
-			r.Post("/login", user.HandleAuthentication(s.Users))
-			r.Post("/register", user.HandleRegistration(s.Users))
-			r.With(AppMiddleware.ValidateJWT).Patch("/", user.HandleUpdateUser(s.Users))
+			r.With(
+				limit("login-ip", ratelimit.PerMinute(20), AppMiddleware.KeyByIP),
+				limit("login-credential", ratelimit.PerMinute(10), AppMiddleware.KeyByCredential),
+			).Post("/login", user.HandleAuthentication(s.Users, s.Sessions, lockout))
+			r.With(limit("login-2fa", ratelimit.PerMinute(10), AppMiddleware.KeyByIP)).
+				Post("/login/2fa", user.HandleTwoFactorLogin(s.Users, s.Sessions))
+			r.With(limit("register", ratelimit.PerHour(10), AppMiddleware.KeyByIP)).
+				Post("/register", user.HandleRegistration(s.Users, s.Sessions))
+			r.With(limit("refresh", ratelimit.PerMinute(30), AppMiddleware.KeyByIP)).
+				Post("/token/refresh", user.HandleRefreshToken(s.Sessions))
+			r.With(
+				limit("password-ip", ratelimit.PerHour(20), AppMiddleware.KeyByIP),
+				limit("password-credential", ratelimit.PerHour(5), AppMiddleware.KeyByCredential),
+			).Post("/password/forgot", user.HandleForgotPassword(s.Users, s.Sender))
+			r.With(limit("password-ip", ratelimit.PerHour(20), AppMiddleware.KeyByIP)).
+				Post("/password/reset", user.HandleResetPassword(s.Users, s.Sessions))
+			r.With(validateJWT).Post("/logout", user.HandleLogout(s.Sessions))
+			r.With(validateJWT).Patch("/", user.HandleUpdateUser(s.Users))
+			r.With(validateJWT).Get("/me", user.HandleGetAccount(s.Users))
+			// Search can tell whether an email address or phone number is in
+			// use, so it is limited like the other lookups by credential.
+			r.With(validateJWT, limit("user-search", ratelimit.PerMinute(30), AppMiddleware.KeyByUser)).
+				Get("/search", user.HandleSearchUsers(s.Users))
+			r.With(validateJWT).Get("/{id}", user.HandleGetProfile(s.Users))
+			r.Route("/2fa", func(r chi.Router) {
+				r.Use(validateJWT, limit("2fa", ratelimit.PerMinute(10), AppMiddleware.KeyByUser))
+				r.Post("/enroll", user.HandleEnrollTwoFactor(s.Users))
+				r.Post("/confirm", user.HandleConfirmTwoFactor(s.Users))
+				r.Post("/disable", user.HandleDisableTwoFactor(s.Users))
+			})
 			r.Route("/link", func(r chi.Router) {
-				r.Use(AppMiddleware.ValidateJWT)
-				r.Post("/", user.HandleLinkEmail(s.Users))
-				r.Post("/phone", user.HandleLinkPhone(s.Users))
+				r.Use(validateJWT)
+				r.Post("/", user.HandleLinkEmail(s.Users, s.Sender))
+				r.Post("/phone", user.HandleLinkPhone(s.Users, s.Sender))
+				r.Post("/verify/send", user.HandleSendVerification(s.Users, s.Sender))
+				r.With(limit("verify", ratelimit.PerMinute(10), AppMiddleware.KeyByUser)).
+					Post("/verify", user.HandleVerifyCredential(s.Users))
 			})
 		})
 		r.Route("/friend", func(r chi.Router) {
-			r.Use(AppMiddleware.ValidateJWT)
+			r.Use(validateJWT)
 			r.Get("/", relationship.Get(s.Relationships))
 			r.Post("/", relationship.Add(s.Relationships))
 			r.Delete("/", relationship.Delete(s.Relationships))
+			r.Route("/request", func(r chi.Router) {
+				r.Get("/", relationship.GetRequests(s.Relationships))
+				r.Post("/", relationship.Add(s.Relationships))
+				r.Post("/{id}/accept", relationship.AcceptRequest(s.Relationships))
+				r.Post("/{id}/reject", relationship.RejectRequest(s.Relationships))
+				r.Post("/{id}/cancel", relationship.CancelRequest(s.Relationships))
+			})
+			r.Get("/mutual/{userId}", relationship.GetMutual(s.Relationships))
+			r.Get("/suggestions", relationship.GetSuggestions(s.Relationships))
+			r.Post("/suggestions/{id}/dismiss", relationship.DismissSuggestion(s.Relationships))
+		})
+
+		r.Route("/follow", func(r chi.Router) {
+			r.Use(validateJWT)
+			r.Post("/", relationship.Follow(s.Relationships))
+			r.Delete("/", relationship.Unfollow(s.Relationships))
+			r.Get("/followers", relationship.GetFollowers(s.Relationships))
+			r.Get("/following", relationship.GetFollowing(s.Relationships))
+			r.Post("/followers/{id}/accept", relationship.AcceptFollower(s.Relationships))
+			r.Delete("/followers/{id}", relationship.RemoveFollower(s.Relationships))
+		})
+
+		r.Route("/block", func(r chi.Router) {
+			r.Use(validateJWT)
+			r.Get("/", relationship.GetBlocks(s.Relationships))
+			r.Post("/", relationship.Block(s.Relationships))
+			r.Delete("/", relationship.Unblock(s.Relationships))
+		})
+		r.Route("/mute", func(r chi.Router) {
+			r.Use(validateJWT)
+			r.Get("/", relationship.GetMutes(s.Relationships))
+			r.Post("/", relationship.Mute(s.Relationships))
+			r.Delete("/", relationship.Unmute(s.Relationships))
 		})
 
 		r.Route("/post", func(r chi.Router) {
-			r.Use(AppMiddleware.ValidateJWT)
+			r.Use(validateJWT)
 			r.Get("/", x.GetPost(s.Posts))
 			r.Post("/", x.Create(s.Posts))
 			r.Post("/comment", x.CreateComment(s.Posts))
+			r.Get("/{id}", x.GetPostById(s.Posts))
+			r.Patch("/{id}", x.Update(s.Posts))
+			r.Delete("/{id}", x.Delete(s.Posts))
+			r.Put("/{id}/reaction", x.SetReaction(s.Posts))
+			r.Delete("/{id}/reaction", x.DeleteReaction(s.Posts))
+			r.Get("/{id}/comments", x.GetComments(s.Posts))
+			r.Patch("/comment/{id}", x.UpdateComment(s.Posts))
+			r.Delete("/comment/{id}", x.DeleteComment(s.Posts))
+			r.Put("/comment/{id}/reaction", x.SetCommentReaction(s.Posts))
+			r.Delete("/comment/{id}/reaction", x.DeleteCommentReaction(s.Posts))
+		})
+
+		r.With(validateJWT).Get("/feed", x.GetFeed(s.Posts))
+
+		r.Route("/notifications", func(r chi.Router) {
+			r.Use(validateJWT)
+			r.Get("/", notification.Get(s.Notifications))
+			r.Post("/read", notification.MarkAllRead(s.Notifications))
+			r.Post("/{id}/read", notification.MarkRead(s.Notifications))
+		})
+
+		r.Route("/conversation", func(r chi.Router) {
+			r.Use(validateJWT)
+			r.Get("/", conversation.Get(s.Conversations))
+			r.Post("/", conversation.Open(s.Conversations))
+			r.Post("/group", conversation.CreateGroup(s.Conversations, s.Blobs))
+			r.Get("/{id}", conversation.GetById(s.Conversations))
+			r.Patch("/{id}", conversation.UpdateGroup(s.Conversations, s.Blobs))
+			r.Get("/{id}/message", conversation.GetMessages(s.Conversations))
+			r.Post("/{id}/message", conversation.SendMessage(s.Conversations))
+			r.Post("/{id}/read", conversation.MarkRead(s.Conversations))
+			r.Put("/{id}/mute", conversation.Mute(s.Conversations))
+			r.Post("/{id}/member", conversation.InviteMember(s.Conversations))
+			r.Delete("/{id}/member/{userId}", conversation.RemoveMember(s.Conversations))
+			r.Put("/{id}/member/{userId}/role", conversation.SetMemberRole(s.Conversations))
+			r.Post("/{id}/leave", conversation.Leave(s.Conversations))
+			r.Post("/{id}/owner", conversation.TransferOwnership(s.Conversations))
 		})
 
 	})
 
 	r.Route("/v1/image", func(r chi.Router) {
-		r.Use(AppMiddleware.ValidateJWT)
-		r.Post("/", image.Upload(s.S3Client))
+		r.Use(validateJWT)
+		r.Post("/", image.Upload(s.Blobs))
 	})
+
+	r.With(validateJWT).Get("/v1/stream", stream.Handle(s.Events))
+
+	if media, ok := s.Blobs.(http.Handler); ok {
+		r.Handle("/media/*", http.StripPrefix("/media/", media))
+	}
 	return r
 }
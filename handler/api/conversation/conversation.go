@@ -0,0 +1,236 @@
+package conversation
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/helper"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	cs "github.com/billymosis/socialmedia-app/store/conversation"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+var (
+	errInvalidConversationId = errors.New("conversation not found")
+	errInvalidMessageId      = errors.New("message not found")
+)
+
+// longPollDeadline leaves a long poll of GetMessages time to answer after its
+// wait is over.
+var longPollDeadline = cs.MaxMessageWait + 10*time.Second
+
+func renderConversationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, cs.ErrConversationNotFound), errors.Is(err, cs.ErrMessageNotFound), errors.Is(err, cs.ErrUserNotFound):
+		render.NotFound(w, err)
+	case errors.Is(err, cs.ErrNotFriend):
+		render.Forbidden(w, err)
+	case errors.Is(err, cs.ErrSelfConversation), errors.Is(err, cs.ErrInvalidAfter), errors.Is(err, cs.ErrInvalidWait),
+		errors.Is(err, helper.ErrInvalidCursor), errors.Is(err, helper.ErrInvalidLimit):
+		render.BadRequest(w, err)
+	default:
+		render.InternalError(w, err)
+	}
+}
+
+func Get(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		response, err := cs.GetConversationList(r.Context(), userId, r.URL.Query())
+		if err != nil {
+			renderConversationError(w, err)
+			return
+		}
+		response.Message = "success"
+		render.JSON(w, response, http.StatusOK)
+	}
+}
+
+func GetById(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidConversationId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		conversation, err := cs.GetConversation(r.Context(), conversationId, userId)
+		if err != nil {
+			renderConversationError(w, err)
+			return
+		}
+		render.JSON(w, conversationResponse{Message: "success", Data: *conversation}, http.StatusOK)
+	}
+}
+
+// Open returns the one-to-one conversation with a friend, starting it if needed.
+func Open(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req openConversationRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := cs.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		otherId, err := strconv.Atoi(req.UserId)
+		if err != nil {
+			render.NotFound(w, err)
+			return
+		}
+
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		conversation, err := cs.OpenDirect(r.Context(), otherId, userId)
+		if err != nil {
+			renderConversationError(w, err)
+			return
+		}
+		render.JSON(w, conversationResponse{Message: "success", Data: *conversation}, http.StatusOK)
+	}
+}
+
+// GetMessages serves the message history, or long polls for new messages when
+// after and wait are given.
+func GetMessages(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidConversationId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if r.URL.Query().Get("wait") != "" {
+			// Long polls outlive the server wide write timeout.
+			err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(longPollDeadline))
+			if err != nil {
+				render.InternalError(w, err)
+				return
+			}
+		}
+		response, err := cs.GetMessages(r.Context(), conversationId, userId, r.URL.Query())
+		if err != nil {
+			renderConversationError(w, err)
+			return
+		}
+		response.Message = "success"
+		render.JSON(w, response, http.StatusOK)
+	}
+}
+
+func SendMessage(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidConversationId)
+			return
+		}
+
+		var req sendMessageRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := cs.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		message, err := cs.SendMessage(r.Context(), conversationId, req.Message, userId)
+		if err != nil {
+			renderConversationError(w, err)
+			return
+		}
+		render.JSON(w, messageResponse{Message: "success", Data: *message}, http.StatusOK)
+	}
+}
+
+// MarkRead records a read receipt. Without a messageId every message of the
+// conversation is marked as read.
+func MarkRead(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidConversationId)
+			return
+		}
+
+		var req markReadRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				render.BadRequest(w, err)
+				return
+			}
+		}
+		messageId := 0
+		if req.MessageId != "" {
+			messageId, err = strconv.Atoi(req.MessageId)
+			if err != nil {
+				render.NotFound(w, errInvalidMessageId)
+				return
+			}
+		}
+
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := cs.MarkRead(r.Context(), conversationId, messageId, userId); err != nil {
+			renderConversationError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
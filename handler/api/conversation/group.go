@@ -0,0 +1,319 @@
+package conversation
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	"github.com/billymosis/socialmedia-app/service/image"
+	cs "github.com/billymosis/socialmedia-app/store/conversation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+)
+
+var (
+	errInvalidUserId = errors.New("user not found")
+	errInvalidAvatar = errors.New("Invalid file type")
+)
+
+// mutedForever is stored for conversations muted without an end.
+var mutedForever = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+func renderGroupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, cs.ErrMemberNotFound):
+		render.NotFound(w, err)
+	case errors.Is(err, cs.ErrForbidden), errors.Is(err, cs.ErrBlockedMember):
+		render.Forbidden(w, err)
+	case errors.Is(err, cs.ErrAlreadyMember), errors.Is(err, cs.ErrOwnerMustTransfer):
+		render.ErrorCode(w, err, http.StatusConflict)
+	case errors.Is(err, cs.ErrNotGroup):
+		render.BadRequest(w, err)
+	default:
+		renderConversationError(w, err)
+	}
+}
+
+// decodeRequest reads and validates a JSON body into req, writing the error
+// response itself when it fails.
+func decodeRequest(w http.ResponseWriter, r *http.Request, validate *validator.Validate, req interface{}) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		render.BadRequest(w, err)
+		return false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, req); err != nil {
+		render.BadRequest(w, err)
+		return false
+	}
+	if err := validate.Struct(req); err != nil {
+		render.BadRequest(w, err)
+		return false
+	}
+	return true
+}
+
+// isAvatarUrl tells whether url is an image uploaded to blobs. Empty clears.
+func isAvatarUrl(blobs image.BlobStore, url *string) bool {
+	if url == nil || *url == "" {
+		return true
+	}
+	return blobs.Owns(*url) && (strings.HasSuffix(*url, ".jpg") || strings.HasSuffix(*url, ".png"))
+}
+
+func CreateGroup(cs *cs.ConversationStore, blobs image.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req createGroupRequest
+		if !decodeRequest(w, r, cs.Validate, &req) {
+			return
+		}
+		if !isAvatarUrl(blobs, req.AvatarUrl) {
+			render.BadRequest(w, errInvalidAvatar)
+			return
+		}
+
+		data := model.GroupData{
+			Title:     req.Title,
+			AvatarUrl: req.AvatarUrl,
+		}
+		for _, id := range req.UserIds {
+			memberId, err := strconv.Atoi(id)
+			if err != nil {
+				render.NotFound(w, errInvalidUserId)
+				return
+			}
+			data.MemberIds = append(data.MemberIds, memberId)
+		}
+
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		conversation, err := cs.CreateGroup(r.Context(), &data, userId)
+		if err != nil {
+			renderGroupError(w, err)
+			return
+		}
+		render.JSON(w, conversationResponse{Message: "success", Data: *conversation}, http.StatusOK)
+	}
+}
+
+func UpdateGroup(cs *cs.ConversationStore, blobs image.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidConversationId)
+			return
+		}
+		var req updateGroupRequest
+		if !decodeRequest(w, r, cs.Validate, &req) {
+			return
+		}
+		if !isAvatarUrl(blobs, req.AvatarUrl) {
+			render.BadRequest(w, errInvalidAvatar)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		update := model.GroupUpdate{
+			Title:     req.Title,
+			AvatarUrl: req.AvatarUrl,
+		}
+		conversation, err := cs.UpdateGroup(r.Context(), conversationId, &update, userId)
+		if err != nil {
+			renderGroupError(w, err)
+			return
+		}
+		render.JSON(w, conversationResponse{Message: "success", Data: *conversation}, http.StatusOK)
+	}
+}
+
+func InviteMember(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidConversationId)
+			return
+		}
+		var req memberRequest
+		if !decodeRequest(w, r, cs.Validate, &req) {
+			return
+		}
+		memberId, err := strconv.Atoi(req.UserId)
+		if err != nil {
+			render.NotFound(w, errInvalidUserId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := cs.InviteMember(r.Context(), conversationId, memberId, userId); err != nil {
+			renderGroupError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+func RemoveMember(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidConversationId)
+			return
+		}
+		memberId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+		if err != nil {
+			render.NotFound(w, errInvalidUserId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := cs.RemoveMember(r.Context(), conversationId, memberId, userId); err != nil {
+			renderGroupError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+func Leave(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidConversationId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := cs.Leave(r.Context(), conversationId, userId); err != nil {
+			renderGroupError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+func TransferOwnership(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidConversationId)
+			return
+		}
+		var req memberRequest
+		if !decodeRequest(w, r, cs.Validate, &req) {
+			return
+		}
+		memberId, err := strconv.Atoi(req.UserId)
+		if err != nil {
+			render.NotFound(w, errInvalidUserId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := cs.TransferOwnership(r.Context(), conversationId, memberId, userId); err != nil {
+			renderGroupError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+func SetMemberRole(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidConversationId)
+			return
+		}
+		memberId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+		if err != nil {
+			render.NotFound(w, errInvalidUserId)
+			return
+		}
+		var req roleRequest
+		if !decodeRequest(w, r, cs.Validate, &req) {
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := cs.SetMemberRole(r.Context(), conversationId, memberId, req.Role, userId); err != nil {
+			renderGroupError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+// Mute stores when a conversation stops being muted for the caller. Muting is
+// up to the clients, see ConversationStore.Mute.
+func Mute(cs *cs.ConversationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidConversationId)
+			return
+		}
+		var req muteRequest
+		if !decodeRequest(w, r, cs.Validate, &req) {
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		var until *time.Time
+		if req.Muted {
+			until = &mutedForever
+			if req.Until != nil {
+				if !req.Until.After(time.Now()) {
+					render.BadRequest(w, errors.New("until must be in the future"))
+					return
+				}
+				until = req.Until
+			}
+		}
+		if err := cs.Mute(r.Context(), conversationId, until, userId); err != nil {
+			renderGroupError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
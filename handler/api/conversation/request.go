@@ -0,0 +1,41 @@
+package conversation
+
+import "time"
+
+type openConversationRequest struct {
+	UserId string `json:"userId" validate:"required"`
+}
+
+type sendMessageRequest struct {
+	Message string `json:"message" validate:"required,min=1,max=2000"`
+}
+
+type markReadRequest struct {
+	MessageId string `json:"messageId"`
+}
+
+type createGroupRequest struct {
+	Title     string   `json:"title" validate:"required,min=1,max=100"`
+	AvatarUrl *string  `json:"avatarUrl" validate:"omitempty,url"`
+	UserIds   []string `json:"userIds" validate:"max=100"`
+}
+
+type updateGroupRequest struct {
+	Title     *string `json:"title" validate:"omitempty,min=1,max=100"`
+	AvatarUrl *string `json:"avatarUrl" validate:"omitempty,url"`
+}
+
+type memberRequest struct {
+	UserId string `json:"userId" validate:"required"`
+}
+
+type roleRequest struct {
+	Role string `json:"role" validate:"required,oneof=admin member"`
+}
+
+type muteRequest struct {
+	Muted bool `json:"muted"`
+	// Until is optional; a muted conversation without it stays muted until it
+	// is unmuted.
+	Until *time.Time `json:"until"`
+}
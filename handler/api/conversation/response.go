@@ -0,0 +1,13 @@
+package conversation
+
+import "github.com/billymosis/socialmedia-app/model"
+
+type conversationResponse struct {
+	Message string                         `json:"message"`
+	Data    model.ConversationResponseData `json:"data"`
+}
+
+type messageResponse struct {
+	Message string                    `json:"message"`
+	Data    model.MessageResponseData `json:"data"`
+}
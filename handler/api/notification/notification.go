@@ -0,0 +1,75 @@
+package notification
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	ns "github.com/billymosis/socialmedia-app/store/notification"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+var errInvalidNotificationId = errors.New("notification not found")
+
+func renderNotificationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ns.ErrNotificationNotFound) {
+		render.NotFound(w, err)
+		return
+	}
+	render.InternalError(w, err)
+}
+
+func Get(ns *ns.NotificationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		response, err := ns.GetNotificationList(r.Context(), userId, r.URL.Query())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		render.JSON(w, response, http.StatusOK)
+	}
+}
+
+func MarkRead(ns *ns.NotificationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notificationId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidNotificationId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		err = ns.MarkRead(r.Context(), notificationId, userId)
+		if err != nil {
+			renderNotificationError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+func MarkAllRead(ns *ns.NotificationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		err = ns.MarkAllRead(r.Context(), userId)
+		if err != nil {
+			render.InternalError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
@@ -1,6 +1,7 @@
 package request
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -8,11 +9,31 @@ import (
 	"strconv"
 
 	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/helper"
 	"github.com/billymosis/socialmedia-app/model"
 	"github.com/billymosis/socialmedia-app/service/auth"
 	ps "github.com/billymosis/socialmedia-app/store/post"
+	"github.com/go-chi/chi/v5"
 )
 
+var (
+	errInvalidPostId    = errors.New("post not found")
+	errInvalidCommentId = errors.New("comment not found")
+)
+
+func renderPostError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ps.ErrPostNotFound), errors.Is(err, ps.ErrCommentNotFound):
+		render.NotFound(w, err)
+	case errors.Is(err, ps.ErrForbidden):
+		render.Forbidden(w, err)
+	case errors.Is(err, ps.ErrEmptyContent):
+		render.BadRequest(w, err)
+	default:
+		render.InternalError(w, err)
+	}
+}
+
 func Create(ps *ps.PostStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req createPostRequest
@@ -35,8 +56,12 @@ func Create(ps *ps.PostStore) http.HandlerFunc {
 		}
 
 		post := model.Post{
-			Html: req.Html,
-			Tags: req.Tags,
+			Html:       req.Html,
+			Tags:       req.Tags,
+			Visibility: req.Visibility,
+		}
+		if post.Visibility == "" {
+			post.Visibility = model.VisibilityPublic
 		}
 		for _, el := range post.Tags {
 			if el == "" {
@@ -52,7 +77,7 @@ func Create(ps *ps.PostStore) http.HandlerFunc {
 
 		err = ps.Create(r.Context(), &post, userId)
 		if err != nil {
-			render.InternalError(w, err)
+			renderPostError(w, err)
 			return
 		}
 		w.WriteHeader(200)
@@ -95,10 +120,18 @@ func CreateComment(ps *ps.PostStore) http.HandlerFunc {
 			PostId:  postid,
 			Comment: req.Comment,
 		}
+		if req.ParentCommentId != "" {
+			parentId, err := strconv.Atoi(req.ParentCommentId)
+			if err != nil {
+				render.NotFound(w, err)
+				return
+			}
+			comment.ParentCommentId = &parentId
+		}
 
 		err = ps.CreateComment(r.Context(), &comment, userId)
 		if err != nil {
-			render.InternalError(w, err)
+			renderPostError(w, err)
 			return
 		}
 		w.WriteHeader(200)
@@ -108,12 +141,301 @@ func CreateComment(ps *ps.PostStore) http.HandlerFunc {
 
 func GetPost(ps *ps.PostStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		response, err := ps.GetPostList(r.Context(), r.URL.Query())
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		response, err := ps.GetPostList(r.Context(), userId, r.URL.Query())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		render.JSON(w, response, http.StatusOK)
+	}
+
+}
+
+func GetFeed(ps *ps.PostStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		response, err := ps.GetFeed(r.Context(), userId, r.URL.Query())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		render.JSON(w, response, http.StatusOK)
+	}
+}
+
+func GetPostById(ps *ps.PostStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		postId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidPostId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		post, err := ps.GetPost(r.Context(), postId, userId)
+		if err != nil {
+			renderPostError(w, err)
+			return
+		}
+		render.JSON(w, model.PostDetailResponse{
+			Message: "success",
+			Data:    *post,
+		}, http.StatusOK)
+	}
+}
+
+func Update(ps *ps.PostStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req updatePostRequest
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := ps.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if req.Html == nil && req.Tags == nil && req.Visibility == nil {
+			render.BadRequest(w, errors.New("nothing to update"))
+			return
+		}
+		for _, el := range req.Tags {
+			if el == "" {
+				render.BadRequest(w, errors.New("Bad Tags"))
+				return
+			}
+		}
+
+		postId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidPostId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		err = ps.Update(r.Context(), postId, &model.PostUpdate{
+			Html:       req.Html,
+			Tags:       req.Tags,
+			Visibility: req.Visibility,
+		}, userId)
+		if err != nil {
+			renderPostError(w, err)
+			return
+		}
+		w.WriteHeader(200)
+	}
+}
+
+func Delete(ps *ps.PostStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		postId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidPostId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		err = ps.Delete(r.Context(), postId, userId)
+		if err != nil {
+			renderPostError(w, err)
+			return
+		}
+		w.WriteHeader(200)
+	}
+}
+
+func SetReaction(ps *ps.PostStore) http.HandlerFunc {
+	return setReaction(ps, ps.SetPostReaction)
+}
+
+func SetCommentReaction(ps *ps.PostStore) http.HandlerFunc {
+	return setReaction(ps, ps.SetCommentReaction)
+}
+
+func DeleteReaction(ps *ps.PostStore) http.HandlerFunc {
+	return deleteReaction(ps.DeletePostReaction)
+}
+
+func DeleteCommentReaction(ps *ps.PostStore) http.HandlerFunc {
+	return deleteReaction(ps.DeleteCommentReaction)
+}
+
+func setReaction(ps *ps.PostStore, set func(ctx context.Context, targetId int, userId int, kind string) (*model.ReactionSummary, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req reactionRequest
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := ps.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		targetId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidPostId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		summary, err := set(r.Context(), targetId, userId, req.Kind)
+		if err != nil {
+			renderPostError(w, err)
+			return
+		}
+		render.JSON(w, reactionResponse{Message: "success", Data: *summary}, http.StatusOK)
+	}
+}
+
+func deleteReaction(remove func(ctx context.Context, targetId int, userId int) (*model.ReactionSummary, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidPostId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
 		if err != nil {
 			render.BadRequest(w, err)
 			return
 		}
+
+		summary, err := remove(r.Context(), targetId, userId)
+		if err != nil {
+			renderPostError(w, err)
+			return
+		}
+		render.JSON(w, reactionResponse{Message: "success", Data: *summary}, http.StatusOK)
+	}
+}
+
+func GetComments(ps *ps.PostStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		postId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidPostId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		response, err := ps.GetComments(r.Context(), postId, userId, r.URL.Query())
+		if err != nil {
+			if errors.Is(err, helper.ErrInvalidCursor) || errors.Is(err, helper.ErrInvalidLimit) {
+				render.BadRequest(w, err)
+				return
+			}
+			renderPostError(w, err)
+			return
+		}
 		render.JSON(w, response, http.StatusOK)
 	}
+}
 
+func UpdateComment(ps *ps.PostStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req updateCommentRequest
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := ps.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		commentId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidCommentId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		err = ps.UpdateComment(r.Context(), commentId, req.Comment, userId)
+		if err != nil {
+			renderPostError(w, err)
+			return
+		}
+		w.WriteHeader(200)
+	}
+}
+
+func DeleteComment(ps *ps.PostStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		commentId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errInvalidCommentId)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		err = ps.DeleteComment(r.Context(), commentId, userId)
+		if err != nil {
+			renderPostError(w, err)
+			return
+		}
+		w.WriteHeader(200)
+	}
 }
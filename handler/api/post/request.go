@@ -1,11 +1,28 @@
 package request
 
+// createPostRequest takes optional tags, the hashtags in Html are added to them.
 type createPostRequest struct {
-	Html string   `json:"postInHtml" validate:"required,min=2,max=500"`
-	Tags []string `json:"tags" validate:"required,min=0"`
+	Html       string   `json:"postInHtml" validate:"required,min=2,max=500"`
+	Tags       []string `json:"tags"`
+	Visibility string   `json:"visibility" validate:"omitempty,oneof=public friends private"`
 }
 
 type createCommentRequest struct {
-	PostId  string `json:"postId" validate:"required"`
+	PostId          string `json:"postId" validate:"required"`
+	ParentCommentId string `json:"parentCommentId"`
+	Comment         string `json:"comment" validate:"required,min=2,max=500"`
+}
+
+type updateCommentRequest struct {
 	Comment string `json:"comment" validate:"required,min=2,max=500"`
 }
+
+type updatePostRequest struct {
+	Html       *string  `json:"postInHtml" validate:"omitempty,min=2,max=500"`
+	Tags       []string `json:"tags" validate:"omitempty"`
+	Visibility *string  `json:"visibility" validate:"omitempty,oneof=public friends private"`
+}
+
+type reactionRequest struct {
+	Kind string `json:"kind" validate:"required,oneof=like love haha wow sad angry"`
+}
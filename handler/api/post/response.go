@@ -0,0 +1,8 @@
+package request
+
+import "github.com/billymosis/socialmedia-app/model"
+
+type reactionResponse struct {
+	Message string                `json:"message"`
+	Data    model.ReactionSummary `json:"data"`
+}
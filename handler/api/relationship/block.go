@@ -0,0 +1,121 @@
+package relationship
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	rs "github.com/billymosis/socialmedia-app/store/relationship"
+	"github.com/pkg/errors"
+)
+
+func renderRestrictError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rs.ErrNotExist):
+		render.NotFound(w, err)
+	case errors.Is(err, rs.ErrSelfRestrict):
+		render.BadRequest(w, err)
+	default:
+		render.InternalError(w, err)
+	}
+}
+
+func Block(rs *rs.RelationshipStore) http.HandlerFunc {
+	return changeRestriction(rs, rs.Block)
+}
+
+func Unblock(rs *rs.RelationshipStore) http.HandlerFunc {
+	return changeRestriction(rs, rs.Unblock)
+}
+
+func Mute(rs *rs.RelationshipStore) http.HandlerFunc {
+	return changeRestriction(rs, rs.Mute)
+}
+
+func Unmute(rs *rs.RelationshipStore) http.HandlerFunc {
+	return changeRestriction(rs, rs.Unmute)
+}
+
+func changeRestriction(rs *rs.RelationshipStore, change func(ctx context.Context, targetId int, userId int) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req addFriendRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := rs.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		targetId, err := strconv.Atoi(req.UserId)
+		if err != nil {
+			render.NotFound(w, err)
+			return
+		}
+
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := change(r.Context(), targetId, userId); err != nil {
+			renderRestrictError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+func GetBlocks(rs *rs.RelationshipStore) http.HandlerFunc {
+	return listRestrictions(rs.GetBlockList)
+}
+
+func GetMutes(rs *rs.RelationshipStore) http.HandlerFunc {
+	return listRestrictions(rs.GetMuteList)
+}
+
+func listRestrictions(list func(ctx context.Context, userId int, queryParams url.Values) (*rs.GetRestrictionListRow, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		users, err := list(r.Context(), userId, r.URL.Query())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		data := make([]Restriction, 0)
+		for _, user := range users.Users {
+			data = append(data, Restriction{
+				CreatedAt: user.CreatedAt,
+				User:      toFriend(user.User),
+			})
+		}
+		res := GetRestrictionListRow{
+			Message: "",
+			Data:    data,
+			Meta: model.Meta{
+				Limit:  users.Meta.Limit,
+				Offset: users.Meta.Offset,
+				Total:  users.Meta.Total,
+			},
+		}
+		render.JSON(w, res, 200)
+	}
+}
@@ -0,0 +1,192 @@
+package relationship
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	rs "github.com/billymosis/socialmedia-app/store/relationship"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+func renderFollowError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rs.ErrNotExist), errors.Is(err, rs.ErrFollowRequestNotFound):
+		render.NotFound(w, err)
+	case errors.Is(err, rs.ErrBlocked):
+		render.Forbidden(w, err)
+	case errors.Is(err, rs.ErrSelfFollow):
+		render.BadRequest(w, err)
+	default:
+		render.InternalError(w, err)
+	}
+}
+
+func readFollowTarget(rs *rs.RelationshipStore, w http.ResponseWriter, r *http.Request) (int, bool) {
+	var req addFriendRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		render.BadRequest(w, err)
+		return 0, false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		render.BadRequest(w, err)
+		return 0, false
+	}
+	if err := rs.Validate.Struct(req); err != nil {
+		render.BadRequest(w, err)
+		return 0, false
+	}
+	targetId, err := strconv.Atoi(req.UserId)
+	if err != nil {
+		render.NotFound(w, errUserNotExist)
+		return 0, false
+	}
+	return targetId, true
+}
+
+// Follow makes the caller follow a user. The response tells whether the follow
+// is accepted or waits for the user's approval.
+func Follow(rs *rs.RelationshipStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetId, ok := readFollowTarget(rs, w, r)
+		if !ok {
+			return
+		}
+
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		status, err := rs.Follow(r.Context(), targetId, userId)
+		if err != nil {
+			renderFollowError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{
+			"message": "success",
+			"data":    map[string]string{"status": status},
+		}, 200)
+	}
+}
+
+func Unfollow(rs *rs.RelationshipStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetId, ok := readFollowTarget(rs, w, r)
+		if !ok {
+			return
+		}
+
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := rs.Unfollow(r.Context(), targetId, userId); err != nil {
+			renderFollowError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+func AcceptFollower(rs *rs.RelationshipStore) http.HandlerFunc {
+	return respondFollower(rs.AcceptFollower)
+}
+
+func RemoveFollower(rs *rs.RelationshipStore) http.HandlerFunc {
+	return respondFollower(rs.RemoveFollower)
+}
+
+func respondFollower(respond func(ctx context.Context, followerId int, userId int) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		followerId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errUserNotExist)
+			return
+		}
+
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := respond(r.Context(), followerId, userId); err != nil {
+			renderFollowError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+// GetFollowers lists the followers of the user given by the userId query
+// parameter, or of the caller when it is left out.
+func GetFollowers(rs *rs.RelationshipStore) http.HandlerFunc {
+	return listFollows(rs.GetFollowerList)
+}
+
+// GetFollowing lists the users followed by the user given by the userId query
+// parameter, or by the caller when it is left out.
+func GetFollowing(rs *rs.RelationshipStore) http.HandlerFunc {
+	return listFollows(rs.GetFollowingList)
+}
+
+func listFollows(list func(ctx context.Context, ownerId int, userId int, queryParams url.Values) (*rs.GetFollowListRow, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		ownerId := userId
+		if param := r.URL.Query().Get("userId"); param != "" {
+			ownerId, err = strconv.Atoi(param)
+			if err != nil {
+				render.NotFound(w, errUserNotExist)
+				return
+			}
+		}
+
+		follows, err := list(r.Context(), ownerId, userId, r.URL.Query())
+		if err != nil {
+			if errors.Is(err, rs.ErrNotExist) {
+				render.NotFound(w, err)
+				return
+			}
+			render.BadRequest(w, err)
+			return
+		}
+		data := make([]FollowEntry, 0)
+		for _, follow := range follows.Follows {
+			data = append(data, FollowEntry{
+				Status:    follow.Status,
+				CreatedAt: follow.CreatedAt,
+				User:      toFriend(follow.User),
+			})
+		}
+		res := GetFollowListRow{
+			Message: "",
+			Data:    data,
+			Meta: model.Meta{
+				Limit:  follows.Meta.Limit,
+				Offset: follows.Meta.Offset,
+				Total:  follows.Meta.Total,
+			},
+		}
+		render.JSON(w, res, 200)
+	}
+}
@@ -0,0 +1,59 @@
+package relationship
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	rs "github.com/billymosis/socialmedia-app/store/relationship"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+func renderMutualError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rs.ErrNotExist):
+		render.NotFound(w, err)
+	default:
+		render.BadRequest(w, err)
+	}
+}
+
+// GetMutual lists the friends the caller has in common with another user.
+func GetMutual(rs *rs.RelationshipStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		otherId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+		if err != nil {
+			render.NotFound(w, errUserNotExist)
+			return
+		}
+
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		users, err := rs.GetMutualFriendList(r.Context(), otherId, userId, r.URL.Query())
+		if err != nil {
+			renderMutualError(w, err)
+			return
+		}
+		data := make([]Friend, 0)
+		for _, user := range users.Friends {
+			data = append(data, toFriend(*user))
+		}
+		res := GetFriendListRow{
+			Message: "",
+			Data:    data,
+			Meta: model.Meta{
+				Limit:  users.Meta.Limit,
+				Offset: users.Meta.Offset,
+				Total:  users.Meta.Total,
+			},
+		}
+		render.JSON(w, res, 200)
+	}
+}
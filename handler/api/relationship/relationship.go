@@ -1,6 +1,7 @@
 package relationship
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -10,8 +11,48 @@ import (
 	"github.com/billymosis/socialmedia-app/model"
 	"github.com/billymosis/socialmedia-app/service/auth"
 	rs "github.com/billymosis/socialmedia-app/store/relationship"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
 )
 
+func renderRequestError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rs.ErrNotExist), errors.Is(err, rs.ErrRequestNotFound):
+		render.NotFound(w, err)
+	case errors.Is(err, rs.ErrAlreadyFriend), errors.Is(err, rs.ErrRequestExist):
+		render.ErrorCode(w, err, http.StatusConflict)
+	case errors.Is(err, rs.ErrBlocked):
+		render.Forbidden(w, err)
+	case errors.Is(err, rs.ErrSelfRequest):
+		render.BadRequest(w, err)
+	default:
+		render.InternalError(w, err)
+	}
+}
+
+func toFriend(user rs.Friend) Friend {
+	return Friend{
+		UserId:       user.UserId,
+		Name:         user.Name,
+		ImageUrl:     user.ImageUrl,
+		FriendCount:  user.FriendCount,
+		CreatedAt:    user.CreatedAt,
+		Relationship: user.Relation.Relationship,
+		MutualCount:  user.Relation.MutualCount,
+	}
+}
+
+func toFriendRequestResponse(request *model.FriendRequest) FriendRequestResponse {
+	var res FriendRequestResponse
+	res.Message = "success"
+	res.Data.RequestId = strconv.Itoa(request.Id)
+	res.Data.SenderId = strconv.Itoa(request.SenderId)
+	res.Data.ReceiverId = strconv.Itoa(request.ReceiverId)
+	res.Data.Status = request.Status
+	res.Data.CreatedAt = request.CreatedAt
+	return res
+}
+
 func Add(rs *rs.RelationshipStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req addFriendRequest
@@ -43,16 +84,81 @@ func Add(rs *rs.RelationshipStore) http.HandlerFunc {
 			return
 		}
 
-		err = rs.AddFriend(r.Context(), userIdRequest, userId)
+		request, err := rs.SendFriendRequest(r.Context(), userIdRequest, userId)
+		if err != nil {
+			renderRequestError(w, err)
+			return
+		}
+		render.JSON(w, toFriendRequestResponse(request), 200)
+	}
+}
+
+func GetRequests(rs *rs.RelationshipStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
 		if err != nil {
-			if err.Error() == "not exist" {
-				render.NotFound(w, err)
-				return
-			}
 			render.BadRequest(w, err)
 			return
 		}
-		w.WriteHeader(200)
+		requests, err := rs.GetFriendRequestList(r.Context(), userId, r.URL.Query())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		data := make([]FriendRequest, 0)
+		for _, request := range requests.Requests {
+			data = append(data, FriendRequest{
+				RequestId: strconv.Itoa(request.Id),
+				Status:    request.Status,
+				CreatedAt: request.CreatedAt,
+				User:      toFriend(request.User),
+			})
+		}
+		res := GetFriendRequestListRow{
+			Message: "",
+			Data:    data,
+			Meta: model.Meta{
+				Limit:  requests.Meta.Limit,
+				Offset: requests.Meta.Offset,
+				Total:  requests.Meta.Total,
+			},
+		}
+		render.JSON(w, res, 200)
+	}
+}
+
+func AcceptRequest(rs *rs.RelationshipStore) http.HandlerFunc {
+	return respondRequest(rs.AcceptFriendRequest)
+}
+
+func RejectRequest(rs *rs.RelationshipStore) http.HandlerFunc {
+	return respondRequest(rs.RejectFriendRequest)
+}
+
+func CancelRequest(rs *rs.RelationshipStore) http.HandlerFunc {
+	return respondRequest(rs.CancelFriendRequest)
+}
+
+func respondRequest(respond func(ctx context.Context, requestId int, userId int) (*model.FriendRequest, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, rs.ErrRequestNotFound)
+			return
+		}
+
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		request, err := respond(r.Context(), requestId, userId)
+		if err != nil {
+			renderRequestError(w, err)
+			return
+		}
+		render.JSON(w, toFriendRequestResponse(request), 200)
 	}
 }
 
@@ -111,13 +217,7 @@ func Get(rs *rs.RelationshipStore) http.HandlerFunc {
 		var data []Friend = make([]Friend, 0)
 		if users != nil {
 			for _, user := range users.Friends {
-				data = append(data, Friend{
-					UserId:      user.UserId,
-					Name:        user.Name,
-					ImageUrl:    user.ImageUrl,
-					FriendCount: user.FriendCount,
-					CreatedAt:   user.CreatedAt,
-				})
+				data = append(data, toFriend(*user))
 			}
 		}
 		res := GetFriendListRow{
@@ -7,11 +7,13 @@ import (
 )
 
 type Friend struct {
-	UserId      string    `json:"userId"`
-	Name        string    `json:"name"`
-	ImageUrl    *string   `json:"imageUrl"`
-	FriendCount int       `json:"friendCount"`
-	CreatedAt   time.Time `json:"createdAt"`
+	UserId       string    `json:"userId"`
+	Name         string    `json:"name"`
+	ImageUrl     *string   `json:"imageUrl"`
+	FriendCount  int       `json:"friendCount"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Relationship string    `json:"relationship"`
+	MutualCount  int       `json:"mutualCount"`
 }
 
 type GetFriendListRow struct {
@@ -19,3 +21,62 @@ type GetFriendListRow struct {
 	Data    []Friend `json:"data"`
 	Meta    model.Meta      `json:"meta"`
 }
+
+type FriendRequest struct {
+	RequestId string    `json:"requestId"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	User      Friend    `json:"user"`
+}
+
+type GetFriendRequestListRow struct {
+	Message string          `json:"message"`
+	Data    []FriendRequest `json:"data"`
+	Meta    model.Meta      `json:"meta"`
+}
+
+type FriendRequestResponse struct {
+	Message string `json:"message"`
+	Data    struct {
+		RequestId  string    `json:"requestId"`
+		SenderId   string    `json:"senderId"`
+		ReceiverId string    `json:"receiverId"`
+		Status     string    `json:"status"`
+		CreatedAt  time.Time `json:"createdAt"`
+	} `json:"data"`
+}
+
+type Suggestion struct {
+	User          Friend `json:"user"`
+	MutualFriends int    `json:"mutualFriends"`
+	SharedTags    int    `json:"sharedTags"`
+}
+
+type GetSuggestionListRow struct {
+	Message string       `json:"message"`
+	Data    []Suggestion `json:"data"`
+	Meta    model.Meta   `json:"meta"`
+}
+
+type Restriction struct {
+	CreatedAt time.Time `json:"createdAt"`
+	User      Friend    `json:"user"`
+}
+
+type GetRestrictionListRow struct {
+	Message string        `json:"message"`
+	Data    []Restriction `json:"data"`
+	Meta    model.Meta    `json:"meta"`
+}
+
+type FollowEntry struct {
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	User      Friend    `json:"user"`
+}
+
+type GetFollowListRow struct {
+	Message string        `json:"message"`
+	Data    []FollowEntry `json:"data"`
+	Meta    model.Meta    `json:"meta"`
+}
@@ -0,0 +1,69 @@
+package relationship
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	rs "github.com/billymosis/socialmedia-app/store/relationship"
+	"github.com/go-chi/chi/v5"
+)
+
+var errUserNotExist = rs.ErrNotExist
+
+func GetSuggestions(rs *rs.RelationshipStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		suggestions, err := rs.GetSuggestionList(r.Context(), userId, r.URL.Query())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		data := make([]Suggestion, 0)
+		for _, suggestion := range suggestions.Suggestions {
+			data = append(data, Suggestion{
+				User:          toFriend(suggestion.User),
+				MutualFriends: suggestion.MutualFriends,
+				SharedTags:    suggestion.SharedTags,
+			})
+		}
+		res := GetSuggestionListRow{
+			Message: "",
+			Data:    data,
+			Meta: model.Meta{
+				Limit:  suggestions.Meta.Limit,
+				Offset: suggestions.Meta.Offset,
+				Total:  suggestions.Meta.Total,
+			},
+		}
+		render.JSON(w, res, 200)
+	}
+}
+
+func DismissSuggestion(rs *rs.RelationshipStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			render.NotFound(w, errUserNotExist)
+			return
+		}
+
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := rs.DismissSuggestion(r.Context(), targetId, userId); err != nil {
+			renderRequestError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	"github.com/billymosis/socialmedia-app/service/realtime"
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+)
+
+const heartbeatInterval = 25 * time.Second
+
+// lastEventId reads the resume position from the Last-Event-ID header sent by
+// EventSource on reconnect, or from the lastEventId query parameter.
+func lastEventId(r *http.Request) uint64 {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	id, _ := strconv.ParseUint(value, 10, 64)
+	return id
+}
+
+// Handle serves the event stream of the authenticated user over WebSocket when
+// the client asks for an upgrade and over Server-Sent Events otherwise.
+func Handle(hub *realtime.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		// Streams outlive the server wide write timeout.
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			render.InternalError(w, err)
+			return
+		}
+
+		sub, missed := hub.Subscribe(userId, lastEventId(r))
+		defer sub.Close()
+
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			websocket.Server{Handler: func(ws *websocket.Conn) {
+				serveWebSocket(ws, sub, missed)
+			}}.ServeHTTP(w, r)
+			return
+		}
+		serveSSE(w, r, sub, missed)
+	}
+}
+
+func serveSSE(w http.ResponseWriter, r *http.Request, sub *realtime.Subscription, missed []realtime.Event) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		render.InternalError(w, errors.New("streaming unsupported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	for _, event := range missed {
+		if err := writeSSE(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event realtime.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+	return err
+}
+
+func serveWebSocket(ws *websocket.Conn, sub *realtime.Subscription, missed []realtime.Event) {
+	defer ws.Close()
+	ws.SetDeadline(time.Time{})
+
+	// Clients do not send anything meaningful; reading only detects when they
+	// go away.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var msg string
+		for {
+			if err := websocket.Message.Receive(ws, &msg); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, event := range missed {
+		if err := websocket.JSON.Send(ws, event); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := websocket.Message.Send(ws, `{"type":"ping"}`); err != nil {
+				return
+			}
+			ws.SetWriteDeadline(time.Time{})
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	"github.com/billymosis/socialmedia-app/service/sender"
+	ss "github.com/billymosis/socialmedia-app/store/session"
+	us "github.com/billymosis/socialmedia-app/store/user"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	errInvalidPhone = errors.New("Invalid phone format")
+	errInvalidEmail = errors.New("Invalid email format")
+)
+
+// Handlers take the store as us, which hides the package, so its errors are
+// referenced through these.
+var (
+	errCredentialNotFound = us.ErrCredentialNotFound
+	errInvalidCode        = us.ErrInvalidCode
+	errAlreadyVerified    = us.ErrAlreadyVerified
+	errTooManyCodes       = us.ErrTooManyCodes
+)
+
+const codeLifetimeMinutes = int(us.CodeLifetime / time.Minute)
+
+func renderCodeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, us.ErrCredentialNotFound):
+		render.NotFound(w, err)
+	case errors.Is(err, us.ErrInvalidCode):
+		render.BadRequest(w, err)
+	case errors.Is(err, us.ErrAlreadyVerified):
+		render.ErrorCode(w, err, http.StatusConflict)
+	case errors.Is(err, us.ErrTooManyCodes):
+		render.ErrorCode(w, err, http.StatusTooManyRequests)
+	default:
+		render.InternalError(w, err)
+	}
+}
+
+func validateCredential(us *us.UserStore, credentialType string, credentialValue string) error {
+	if credentialType == model.CredentialTypePhone {
+		if err := us.Validate.Var(credentialValue, "required,min=7,max=13,startswith=+"); err != nil {
+			return errInvalidPhone
+		}
+	}
+	if credentialType == model.CredentialTypeEmail {
+		if err := us.Validate.Var(credentialValue, "email,required"); err != nil {
+			return errInvalidEmail
+		}
+	}
+	return nil
+}
+
+// sendCode issues a one-time code for purpose and delivers it to credential.
+func sendCode(ctx context.Context, us *us.UserStore, s sender.Sender, credential *model.Credential, purpose string) error {
+	code, err := us.IssueCode(ctx, credential.Id, purpose)
+	if err != nil {
+		return err
+	}
+	var message string
+	switch purpose {
+	case model.CodePasswordReset:
+		message = fmt.Sprintf("Your password reset code is %s. It expires in %d minutes.", code, codeLifetimeMinutes)
+	case model.CodeVerifyCredential:
+		message = fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", code, codeLifetimeMinutes)
+	}
+	return s.Send(ctx, credential.CredentialType, credential.CredentialValue, message)
+}
+
+// HandleForgotPassword sends a reset code to a linked email or phone. It answers
+// the same way whether or not the credential exists so that it cannot be used
+// to find out who is registered.
+func HandleForgotPassword(us *us.UserStore, s sender.Sender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req forgotPasswordRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := us.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := validateCredential(us, req.CredentialType, req.CredentialValue); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		credential, err := us.GetCredential(r.Context(), req.CredentialType, req.CredentialValue)
+		if err == nil {
+			err = sendCode(r.Context(), us, s, credential, model.CodePasswordReset)
+		}
+		if err != nil && !errors.Is(err, errCredentialNotFound) && !errors.Is(err, errTooManyCodes) {
+			render.InternalError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{
+			"message": "If the account exists, a reset code has been sent",
+		}, http.StatusOK)
+	}
+}
+
+// HandleResetPassword sets a new password with a code from HandleForgotPassword
+// and signs the user out of every session.
+func HandleResetPassword(us *us.UserStore, ss *ss.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req resetPasswordRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := us.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := validateCredential(us, req.CredentialType, req.CredentialValue); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		credential, err := us.GetCredential(r.Context(), req.CredentialType, req.CredentialValue)
+		if errors.Is(err, errCredentialNotFound) {
+			render.BadRequest(w, errInvalidCode)
+			return
+		}
+		if err != nil {
+			render.InternalError(w, err)
+			return
+		}
+
+		user := model.User{Password: req.Password}
+		if err := user.HashPassword(); err != nil {
+			render.InternalError(w, err)
+			return
+		}
+		if err := us.ResetPassword(r.Context(), credential, req.Code, user.Password); err != nil {
+			renderCodeError(w, err)
+			return
+		}
+		if err := ss.RevokeAll(r.Context(), credential.UserId); err != nil {
+			render.InternalError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+// HandleSendVerification sends a verification code to the email or phone linked
+// to the authenticated user.
+func HandleSendVerification(us *us.UserStore, s sender.Sender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req sendVerificationRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := us.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		credential, err := us.GetUserCredential(r.Context(), userId, req.CredentialType)
+		if err != nil {
+			renderCodeError(w, err)
+			return
+		}
+		if credential.VerifiedAt != nil {
+			renderCodeError(w, errAlreadyVerified)
+			return
+		}
+		if err := sendCode(r.Context(), us, s, credential, model.CodeVerifyCredential); err != nil {
+			renderCodeError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+func HandleVerifyCredential(us *us.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req verifyCredentialRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := us.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		credential, err := us.GetUserCredential(r.Context(), userId, req.CredentialType)
+		if err != nil {
+			renderCodeError(w, err)
+			return
+		}
+		if err := us.VerifyCredential(r.Context(), credential, req.Code); err != nil {
+			renderCodeError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+// sendLinkVerification starts verifying a freshly linked credential. Linking
+// already succeeded at this point, so failures are only logged; the user can
+// ask for another code.
+func sendLinkVerification(r *http.Request, us *us.UserStore, s sender.Sender, userId int, credentialType string) {
+	credential, err := us.GetUserCredential(r.Context(), userId, credentialType)
+	if err == nil {
+		err = sendCode(r.Context(), us, s, credential, model.CodeVerifyCredential)
+	}
+	if err != nil {
+		logrus.WithError(err).Warn("failed to send verification code")
+	}
+}
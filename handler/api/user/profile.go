@@ -0,0 +1,115 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	us "github.com/billymosis/socialmedia-app/store/user"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+var (
+	errUserNotFound = us.ErrUserNotFound
+	errEmptySearch  = us.ErrEmptySearch
+	errInvalidPage  = us.ErrInvalidPage
+)
+
+// HandleGetProfile returns the public profile of another user, found by id or
+// handle, with how they relate to the caller.
+func HandleGetProfile(us *us.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		// Handles are never all digits, so anything else is looked up as one.
+		param := chi.URLParam(r, "id")
+		id, err := strconv.Atoi(param)
+		if err != nil {
+			id, err = us.GetIdByHandle(r.Context(), strings.TrimPrefix(param, "@"))
+			if err != nil {
+				if errors.Is(err, errUserNotFound) {
+					render.NotFound(w, err)
+					return
+				}
+				render.InternalError(w, err)
+				return
+			}
+		}
+
+		profile, err := us.GetProfile(r.Context(), id, userId)
+		if err != nil {
+			if errors.Is(err, errUserNotFound) {
+				render.NotFound(w, err)
+				return
+			}
+			render.InternalError(w, err)
+			return
+		}
+
+		var res profileResponse
+		res.Message = "success"
+		res.Data = *profile
+		render.JSON(w, res, http.StatusOK)
+	}
+}
+
+// HandleGetAccount returns the caller's own account with the credentials linked
+// to it.
+func HandleGetAccount(us *us.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		account, err := us.GetAccount(r.Context(), userId)
+		if err != nil {
+			if errors.Is(err, errUserNotFound) {
+				render.NotFound(w, err)
+				return
+			}
+			render.InternalError(w, err)
+			return
+		}
+
+		var res accountResponse
+		res.Message = "success"
+		res.Data = *account
+		render.JSON(w, res, http.StatusOK)
+	}
+}
+
+// HandleSearchUsers finds other users by name, handle, or the email address or
+// phone number they allow to be found by.
+func HandleSearchUsers(us *us.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		result, err := us.SearchUsers(r.Context(), userId, r.URL.Query())
+		if err != nil {
+			if errors.Is(err, errEmptySearch) || errors.Is(err, errInvalidPage) {
+				render.BadRequest(w, err)
+				return
+			}
+			render.InternalError(w, err)
+			return
+		}
+
+		var res searchUsersResponse
+		res.Message = "success"
+		res.Data = result.Users
+		res.Meta = result.Meta
+		render.JSON(w, res, http.StatusOK)
+	}
+}
@@ -21,7 +21,53 @@ type linkPhoneRequest struct {
 	Phone string `json:"phone" validate:"required,startswith=+,min=7,max=13"`
 }
 
+// updateUserRequest only changes the fields that are present. Handles are
+// checked by the store, and an empty website clears it.
 type updateUserRequest struct {
-	ImageUrl string `json:"imageUrl" validate:"required,url"`
-	Name     string `json:"name" validate:"required,min=5,max=50"`
+	ImageUrl *string `json:"imageUrl" validate:"omitempty,url"`
+	Name     *string `json:"name" validate:"omitempty,min=5,max=50"`
+	Handle   *string `json:"handle"`
+	Bio      *string `json:"bio" validate:"omitempty,max=160"`
+	Website  *string `json:"website"`
+	Location *string `json:"location" validate:"omitempty,max=50"`
+
+	DiscoverableByEmail   *bool `json:"discoverableByEmail"`
+	DiscoverableByPhone   *bool `json:"discoverableByPhone"`
+	FollowersNeedApproval *bool `json:"followersNeedApproval"`
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+type forgotPasswordRequest struct {
+	CredentialType  string `json:"credentialType" validate:"required,oneof=phone email"`
+	CredentialValue string `json:"credentialValue" validate:"required"`
+}
+
+type resetPasswordRequest struct {
+	CredentialType  string `json:"credentialType" validate:"required,oneof=phone email"`
+	CredentialValue string `json:"credentialValue" validate:"required"`
+	Code            string `json:"code" validate:"required,numeric,len=6"`
+	Password        string `json:"password" validate:"required,min=5,max=15"`
+}
+
+type sendVerificationRequest struct {
+	CredentialType string `json:"credentialType" validate:"required,oneof=phone email"`
+}
+
+type verifyCredentialRequest struct {
+	CredentialType string `json:"credentialType" validate:"required,oneof=phone email"`
+	Code           string `json:"code" validate:"required,numeric,len=6"`
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required,min=6,max=20"`
+}
+
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	// Code is either the current code of the authenticator app or one of the
+	// recovery codes.
+	Code string `json:"code" validate:"required,min=6,max=20"`
 }
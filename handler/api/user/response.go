@@ -1,21 +1,77 @@
 package user
 
+import (
+	"time"
+
+	"github.com/billymosis/socialmedia-app/model"
+)
+
 type loginUserResponse struct {
 	Message string `json:"message"`
 	Data    struct {
-		Phone       string `json:"phone"`
-		Email       string `json:"email"`
-		Name        string `json:"name"`
-		AccessToken string `json:"accessToken"`
+		Phone        string `json:"phone"`
+		Email        string `json:"email"`
+		Name         string `json:"name"`
+		AccessToken  string `json:"accessToken"`
+		RefreshToken string `json:"refreshToken"`
 	} `json:"data"`
 }
 
 type createUserResponse struct {
 	Message string `json:"message"`
 	Data    struct {
-		Phone       string `json:"phone,omitempty" validate:"min=7,max13"`
-		Email       string `json:"email,omitempty" validate:"email"`
-		Name        string `json:"name" validate:"required,min=5,max=50"`
-		AccessToken string `json:"accessToken" validate:"required,min=5,max=15"`
+		Phone        string `json:"phone,omitempty" validate:"min=7,max13"`
+		Email        string `json:"email,omitempty" validate:"email"`
+		Name         string `json:"name" validate:"required,min=5,max=50"`
+		AccessToken  string `json:"accessToken" validate:"required,min=5,max=15"`
+		RefreshToken string `json:"refreshToken"`
+	} `json:"data"`
+}
+
+type refreshTokenResponse struct {
+	Message string `json:"message"`
+	Data    struct {
+		AccessToken  string `json:"accessToken"`
+		RefreshToken string `json:"refreshToken"`
+	} `json:"data"`
+}
+
+type loginChallengeResponse struct {
+	Message string `json:"message"`
+	Data    struct {
+		TwoFactorRequired bool      `json:"twoFactorRequired"`
+		ChallengeToken    string    `json:"challengeToken"`
+		ExpiresAt         time.Time `json:"expiresAt"`
+	} `json:"data"`
+}
+
+type enrollTwoFactorResponse struct {
+	Message string `json:"message"`
+	Data    struct {
+		Secret     string `json:"secret"`
+		OtpauthUri string `json:"otpauthUri"`
+	} `json:"data"`
+}
+
+type recoveryCodesResponse struct {
+	Message string `json:"message"`
+	Data    struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
 	} `json:"data"`
 }
+
+type profileResponse struct {
+	Message string            `json:"message"`
+	Data    model.UserProfile `json:"data"`
+}
+
+type searchUsersResponse struct {
+	Message string              `json:"message"`
+	Data    []model.UserProfile `json:"data"`
+	Meta    model.Meta          `json:"meta"`
+}
+
+type accountResponse struct {
+	Message string        `json:"message"`
+	Data    model.Account `json:"data"`
+}
@@ -0,0 +1,179 @@
+package user
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	ss "github.com/billymosis/socialmedia-app/store/session"
+	us "github.com/billymosis/socialmedia-app/store/user"
+	"github.com/pkg/errors"
+)
+
+func renderTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, us.ErrTwoFactorEnabled):
+		render.ErrorCode(w, err, http.StatusConflict)
+	case errors.Is(err, us.ErrTwoFactorNotEnrolled), errors.Is(err, us.ErrInvalidCode):
+		render.BadRequest(w, err)
+	case errors.Is(err, us.ErrInvalidChallenge):
+		render.Unauthorized(w, err)
+	default:
+		render.InternalError(w, err)
+	}
+}
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "socialmedia-app"
+}
+
+// HandleEnrollTwoFactor creates a new TOTP secret for the authenticated user.
+// It only takes effect once a code from it is confirmed.
+func HandleEnrollTwoFactor(us *us.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		secret, err := auth.GenerateTOTPSecret()
+		if err != nil {
+			render.InternalError(w, err)
+			return
+		}
+		name, err := us.EnrollTOTP(r.Context(), userId, secret)
+		if err != nil {
+			renderTwoFactorError(w, err)
+			return
+		}
+
+		var res enrollTwoFactorResponse
+		res.Message = "success"
+		res.Data.Secret = secret
+		res.Data.OtpauthUri = auth.TOTPURI(totpIssuer(), name, secret)
+		render.JSON(w, res, http.StatusOK)
+	}
+}
+
+// HandleConfirmTwoFactor enables two-factor authentication and returns the
+// recovery codes. They are only ever shown here.
+func HandleConfirmTwoFactor(us *us.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req twoFactorCodeRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := us.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		codes, hashes, err := auth.GenerateRecoveryCodes()
+		if err != nil {
+			render.InternalError(w, err)
+			return
+		}
+		if err := us.ConfirmTOTP(r.Context(), userId, req.Code, hashes); err != nil {
+			renderTwoFactorError(w, err)
+			return
+		}
+
+		var res recoveryCodesResponse
+		res.Message = "success"
+		res.Data.RecoveryCodes = codes
+		render.JSON(w, res, http.StatusOK)
+	}
+}
+
+func HandleDisableTwoFactor(us *us.UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req twoFactorCodeRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := us.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := us.DisableTOTP(r.Context(), userId, req.Code); err != nil {
+			renderTwoFactorError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+// HandleTwoFactorLogin finishes a login started by HandleAuthentication for a
+// user with two-factor authentication enabled.
+func HandleTwoFactorLogin(us *us.UserStore, ss *ss.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req twoFactorLoginRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		if err := us.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		userId, err := us.CompleteLoginChallenge(r.Context(), auth.HashToken(req.ChallengeToken), req.Code)
+		if err != nil {
+			renderTwoFactorError(w, err)
+			return
+		}
+
+		tokens, err := issueTokens(r, ss, userId)
+		if err != nil {
+			render.InternalError(w, err)
+			return
+		}
+
+		var res refreshTokenResponse
+		res.Message = "User logged successfully"
+		res.Data.AccessToken = tokens.AccessToken
+		res.Data.RefreshToken = tokens.RefreshToken
+		render.JSON(w, res, http.StatusOK)
+	}
+}
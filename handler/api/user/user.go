@@ -4,19 +4,46 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/billymosis/socialmedia-app/handler/render"
 	"github.com/billymosis/socialmedia-app/model"
 	"github.com/billymosis/socialmedia-app/service/auth"
+	"github.com/billymosis/socialmedia-app/service/ratelimit"
+	"github.com/billymosis/socialmedia-app/service/sender"
+	ss "github.com/billymosis/socialmedia-app/store/session"
 	us "github.com/billymosis/socialmedia-app/store/user"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pkg/errors"
 )
 
-func HandleAuthentication(us *us.UserStore) http.HandlerFunc {
+var errAccountLocked = errors.New("too many failed logins, try again later")
+
+func issueTokens(r *http.Request, ss *ss.SessionStore, userId int) (*auth.TokenPair, error) {
+	refreshToken, refreshHash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	session, err := ss.Create(r.Context(), userId, refreshHash, time.Now().Add(auth.RefreshTokenLifetime))
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := auth.GenerateToken(userId, session.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &auth.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+func HandleAuthentication(us *us.UserStore, ss *ss.SessionStore, lockout *ratelimit.Lockout) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req loginUserRequest
 
@@ -52,31 +79,82 @@ func HandleAuthentication(us *us.UserStore) http.HandlerFunc {
 			}
 
 		}
+		locked, err := lockout.Locked(r.Context(), req.CredentialValue)
+		if err != nil {
+			render.InternalError(w, err)
+			return
+		}
+		if locked > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.Seconds()))))
+			render.ErrorCode(w, errAccountLocked, http.StatusTooManyRequests)
+			return
+		}
+
 		var user *model.UserAndCred
 		user, err = us.GetByCredential(r.Context(), req.CredentialValue)
 
 		if err != nil {
+			if _, err := lockout.Fail(r.Context(), req.CredentialValue); err != nil {
+				render.InternalError(w, err)
+				return
+			}
 			render.NotFound(w, errors.New("User not found"))
 			return
 		}
 
 		validUser := user.CheckPassword(req.Password)
 		if !validUser {
+			if _, err := lockout.Fail(r.Context(), req.CredentialValue); err != nil {
+				render.InternalError(w, err)
+				return
+			}
 			render.BadRequest(w, errors.New("Invalid username or password"))
 			return
 
 		}
+		if err := lockout.Succeed(r.Context(), req.CredentialValue); err != nil {
+			render.InternalError(w, err)
+			return
+		}
 
-		token, err := auth.GenerateToken(user.Id)
+		twoFactor, err := us.TwoFactorEnabled(r.Context(), user.Id)
 		if err != nil {
-			render.BadRequest(w, err)
+			render.InternalError(w, err)
+			return
+		}
+		if twoFactor {
+			// The password alone is not enough; hand out a challenge that
+			// HandleTwoFactorLogin exchanges for tokens.
+			challenge, challengeHash, err := auth.GenerateRefreshToken()
+			if err != nil {
+				render.InternalError(w, err)
+				return
+			}
+			expiresAt, err := us.CreateLoginChallenge(r.Context(), user.Id, challengeHash)
+			if err != nil {
+				render.InternalError(w, err)
+				return
+			}
+			var res loginChallengeResponse
+			res.Message = "Two-factor authentication required"
+			res.Data.TwoFactorRequired = true
+			res.Data.ChallengeToken = challenge
+			res.Data.ExpiresAt = expiresAt
+			render.JSON(w, res, http.StatusOK)
+			return
+		}
+
+		tokens, err := issueTokens(r, ss, user.Id)
+		if err != nil {
+			render.InternalError(w, err)
 			return
 		}
 
 		var res loginUserResponse
 		res.Message = "User logged successfully"
 		res.Data.Name = user.Name
-		res.Data.AccessToken = token
+		res.Data.AccessToken = tokens.AccessToken
+		res.Data.RefreshToken = tokens.RefreshToken
 		if req.CredentialType == "email" {
 			res.Data.Email = req.CredentialValue
 		}
@@ -94,7 +172,7 @@ func HandleAuthentication(us *us.UserStore) http.HandlerFunc {
 	}
 }
 
-func HandleRegistration(us *us.UserStore) http.HandlerFunc {
+func HandleRegistration(us *us.UserStore, ss *ss.SessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		var req createUserRequest
@@ -152,7 +230,7 @@ func HandleRegistration(us *us.UserStore) http.HandlerFunc {
 			return
 		}
 
-		token, err := auth.GenerateToken(userId)
+		tokens, err := issueTokens(r, ss, userId)
 		if err != nil {
 			render.InternalError(w, err)
 			return
@@ -161,7 +239,8 @@ func HandleRegistration(us *us.UserStore) http.HandlerFunc {
 		var res createUserResponse
 		res.Message = "User registered successfully"
 		res.Data.Name = user.Name
-		res.Data.AccessToken = token
+		res.Data.AccessToken = tokens.AccessToken
+		res.Data.RefreshToken = tokens.RefreshToken
 		if req.CredentialType == "phone" {
 			res.Data.Phone = req.CredentialValue
 		}
@@ -173,7 +252,78 @@ func HandleRegistration(us *us.UserStore) http.HandlerFunc {
 	}
 }
 
-func HandleLinkEmail(us *us.UserStore) http.HandlerFunc {
+func HandleRefreshToken(sessions *ss.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req refreshTokenRequest
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		if err := sessions.Validate.Struct(req); err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+
+		refreshToken, refreshHash, err := auth.GenerateRefreshToken()
+		if err != nil {
+			render.InternalError(w, err)
+			return
+		}
+
+		session, err := sessions.Rotate(r.Context(), auth.HashToken(req.RefreshToken), refreshHash)
+		if err != nil {
+			if errors.Is(err, ss.ErrInvalidToken) || errors.Is(err, ss.ErrTokenReused) {
+				render.Unauthorized(w, err)
+				return
+			}
+			render.InternalError(w, err)
+			return
+		}
+
+		accessToken, err := auth.GenerateToken(session.UserId, session.Id)
+		if err != nil {
+			render.InternalError(w, err)
+			return
+		}
+
+		var res refreshTokenResponse
+		res.Message = "Token refreshed successfully"
+		res.Data.AccessToken = accessToken
+		res.Data.RefreshToken = refreshToken
+		render.JSON(w, res, http.StatusOK)
+	}
+}
+
+func HandleLogout(ss *ss.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, err := auth.GetUserId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		sessionId, err := auth.GetSessionId(r.Context())
+		if err != nil {
+			render.BadRequest(w, err)
+			return
+		}
+		err = ss.Revoke(r.Context(), sessionId, userId)
+		if err != nil {
+			render.InternalError(w, err)
+			return
+		}
+		render.JSON(w, map[string]interface{}{}, 200)
+	}
+}
+
+func HandleLinkEmail(us *us.UserStore, s sender.Sender) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req linkEmailRequest
 		body, err := io.ReadAll(r.Body)
@@ -208,11 +358,12 @@ func HandleLinkEmail(us *us.UserStore) http.HandlerFunc {
 			render.BadRequest(w, err)
 			return
 		}
+		sendLinkVerification(r, us, s, userId, model.CredentialTypeEmail)
 		render.JSON(w, map[string]interface{}{}, 200)
 	}
 }
 
-func HandleLinkPhone(us *us.UserStore) http.HandlerFunc {
+func HandleLinkPhone(us *us.UserStore, s sender.Sender) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req linkPhoneRequest
 		body, err := io.ReadAll(r.Body)
@@ -249,10 +400,26 @@ func HandleLinkPhone(us *us.UserStore) http.HandlerFunc {
 			render.BadRequest(w, err)
 			return
 		}
+		sendLinkVerification(r, us, s, userId, model.CredentialTypePhone)
 		render.JSON(w, map[string]interface{}{}, 200)
 	}
 }
 
+func renderUpdateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, us.ErrInvalidHandle), errors.Is(err, us.ErrReservedHandle):
+		render.BadRequest(w, err)
+	case errors.Is(err, us.ErrHandleTaken):
+		render.ErrorCode(w, err, http.StatusConflict)
+	case errors.Is(err, us.ErrHandleCooldown):
+		render.ErrorCode(w, err, http.StatusTooManyRequests)
+	case errors.Is(err, us.ErrUserNotFound):
+		render.NotFound(w, err)
+	default:
+		render.InternalError(w, err)
+	}
+}
+
 func HandleUpdateUser(us *us.UserStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req updateUserRequest
@@ -268,7 +435,7 @@ func HandleUpdateUser(us *us.UserStore) http.HandlerFunc {
 			return
 		}
 
-		if !strings.HasSuffix(req.ImageUrl, ".jpg") && !strings.HasSuffix(req.ImageUrl, ".jpeg") && !strings.HasSuffix(req.ImageUrl, ".png") {
+		if req.ImageUrl != nil && !strings.HasSuffix(*req.ImageUrl, ".jpg") && !strings.HasSuffix(*req.ImageUrl, ".jpeg") && !strings.HasSuffix(*req.ImageUrl, ".png") {
 			render.BadRequest(w, errors.New("Invalid file type"))
 			return
 		}
@@ -277,15 +444,38 @@ func HandleUpdateUser(us *us.UserStore) http.HandlerFunc {
 			render.BadRequest(w, err)
 			return
 		}
+		if req.Website != nil && *req.Website != "" {
+			if err := us.Validate.Var(*req.Website, "http_url,max=255"); err != nil {
+				render.BadRequest(w, errors.New("Invalid website"))
+				return
+			}
+		}
+		if req.ImageUrl == nil && req.Name == nil && req.Handle == nil && req.Bio == nil && req.Website == nil && req.Location == nil &&
+			req.DiscoverableByEmail == nil && req.DiscoverableByPhone == nil && req.FollowersNeedApproval == nil {
+			render.BadRequest(w, errors.New("nothing to update"))
+			return
+		}
 
 		userId, err := auth.GetUserId(r.Context())
 		if err != nil {
 			render.BadRequest(w, err)
 			return
 		}
-		err = us.UpdateUser(r.Context(), req.ImageUrl, req.Name, userId)
+		err = us.UpdateUser(r.Context(), &model.UserUpdate{
+			Name:     req.Name,
+			ImageUrl: req.ImageUrl,
+			Handle:   req.Handle,
+			Bio:      req.Bio,
+			Website:  req.Website,
+			Location: req.Location,
+
+			DiscoverableByEmail:   req.DiscoverableByEmail,
+			DiscoverableByPhone:   req.DiscoverableByPhone,
+			FollowersNeedApproval: req.FollowersNeedApproval,
+		}, userId)
 		if err != nil {
-			render.InternalError(w, err)
+			renderUpdateError(w, err)
+			return
 		}
 		render.JSON(w, map[string]interface{}{}, 200)
 	}
@@ -0,0 +1,58 @@
+package helper
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidCursor = errors.New("bad request: invalid cursor")
+	ErrInvalidLimit  = errors.New("bad request: invalid limit")
+)
+
+// EncodeCursor builds an opaque pagination cursor pointing at a row ordered by
+// (createdAt, id).
+func EncodeCursor(createdAt time.Time, id int) string {
+	raw := fmt.Sprintf("%d:%d", createdAt.UnixNano(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(cursor string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.Unix(0, nanos).UTC(), id, nil
+}
+
+// CursorLimit reads the limit query parameter used by cursor paginated lists.
+func CursorLimit(limitStr string, fallback int, maximum int) (int, error) {
+	if limitStr == "" {
+		return fallback, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		return 0, ErrInvalidLimit
+	}
+	if limit > maximum {
+		limit = maximum
+	}
+	return limit, nil
+}
@@ -2,26 +2,107 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/billymosis/socialmedia-app/db"
 	"github.com/billymosis/socialmedia-app/handler/api"
+	"github.com/billymosis/socialmedia-app/service/image"
+	"github.com/billymosis/socialmedia-app/service/job"
+	"github.com/billymosis/socialmedia-app/service/ratelimit"
+	"github.com/billymosis/socialmedia-app/service/realtime"
+	"github.com/billymosis/socialmedia-app/service/sender"
+	cs "github.com/billymosis/socialmedia-app/store/conversation"
+	ns "github.com/billymosis/socialmedia-app/store/notification"
 	pss "github.com/billymosis/socialmedia-app/store/post"
 	rs "github.com/billymosis/socialmedia-app/store/relationship"
+	ss "github.com/billymosis/socialmedia-app/store/session"
 	us "github.com/billymosis/socialmedia-app/store/user"
 	"github.com/go-playground/validator/v10"
 	// "github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 )
 
+// newBlobStore picks the upload backend from BLOB_STORE. It defaults to S3 so
+// existing deployments keep working without new configuration.
+func newBlobStore() (image.BlobStore, error) {
+	switch os.Getenv("BLOB_STORE") {
+	case "local":
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "./media"
+		}
+		return image.NewLocalBlobStore(dir, os.Getenv("MEDIA_BASE_URL")+"/media")
+	case "memory":
+		return image.NewMemoryBlobStore(os.Getenv("MEDIA_BASE_URL") + "/media"), nil
+	case "s3", "":
+	default:
+		return nil, fmt.Errorf("unsupported BLOB_STORE %q", os.Getenv("BLOB_STORE"))
+	}
+
+	cfg, err := config.LoadDefaultConfig(
+		context.TODO(),
+		config.WithRegion(os.Getenv("S3_REGION")),
+		config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(
+				os.Getenv("S3_ID"), os.Getenv("S3_SECRET_KEY"), "",
+			)))
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := os.Getenv("S3_BUCKET_NAME")
+	baseURL := os.Getenv("S3_PUBLIC_URL")
+	endpoint := os.Getenv("S3_ENDPOINT")
+	s3Client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	if baseURL == "" && endpoint != "" {
+		baseURL = strings.TrimSuffix(endpoint, "/") + "/" + bucket
+	}
+	return image.NewS3BlobStore(s3Client, bucket, baseURL), nil
+}
+
+// newSender picks how one-time codes are delivered from SENDER. Only the
+// development senders exist so far; they log or write codes to SENDER_FILE.
+func newSender() (sender.Sender, error) {
+	switch os.Getenv("SENDER") {
+	case "file":
+		path := os.Getenv("SENDER_FILE")
+		if path == "" {
+			path = "./sent_codes.log"
+		}
+		return sender.NewFileSender(path), nil
+	case "log", "":
+		return sender.NewLogSender(), nil
+	default:
+		return nil, fmt.Errorf("unsupported SENDER %q", os.Getenv("SENDER"))
+	}
+}
+
+// suggestionInterval is how often friend suggestions are recomputed, from
+// SUGGESTION_INTERVAL. It defaults to an hour.
+func suggestionInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("SUGGESTION_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return time.Hour
+	}
+	return interval
+}
+
 func main() {
 
 	// if err := godotenv.Load(); err != nil {
@@ -33,29 +114,44 @@ func main() {
 	port := os.Getenv("DB_PORT")
 	user := os.Getenv("DB_USERNAME")
 	password := os.Getenv("DB_PASSWORD")
-	region := os.Getenv("S3_REGION")
 
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithRegion(region),
-		config.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(
-				os.Getenv("S3_ID"), os.Getenv("S3_SECRET_KEY"), "",
-			)))
+	blobStore, err := newBlobStore()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	s3Client := s3.NewFromConfig(cfg)
+	codeSender, err := newSender()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	db, err := db.Connection("postgres", host, database, user, password, port)
 	if err != nil {
 		log.Fatal(err)
 	}
 	validate := validator.New()
+	events := realtime.NewHub()
 
 	userStore := us.NewUserStore(db, validate)
-	relationStore := rs.NewRelationshipStore(db, validate)
-	postStore := pss.NewPostStore(db, validate)
-
-	r := api.New(userStore, relationStore, postStore, s3Client)
+	relationStore := rs.NewRelationshipStore(db, validate, events)
+	postStore := pss.NewPostStore(db, validate, events)
+	sessionStore := ss.NewSessionStore(db, validate)
+	notificationStore := ns.NewNotificationStore(db, validate)
+	conversationStore := cs.NewConversationStore(db, validate, events)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go job.Every(ctx, "friend-suggestions", suggestionInterval(), func(ctx context.Context) error {
+		n, err := relationStore.RefreshSuggestions(ctx, 100)
+		logrus.Infof("refreshed friend suggestions of %d users", n)
+		return err
+	})
+	go job.Every(ctx, "realtime-sweep", realtime.SweepInterval, func(ctx context.Context) error {
+		events.Sweep()
+		return nil
+	})
+
+	r := api.New(userStore, relationStore, postStore, sessionStore, notificationStore, conversationStore, blobStore, events, codeSender, ratelimit.NewMemoryStore())
 	h := r.Handler()
 
 	logrus.Info("application starting billy fixed env")
@@ -84,6 +180,7 @@ func main() {
 	<-quit
 
 	logrus.Info("application shutting down")
+	cancel()
 
 	log.Println("database closing")
 	db.Close()
@@ -8,42 +8,59 @@ import (
 	"strings"
 
 	"github.com/billymosis/socialmedia-app/handler/render"
+	ss "github.com/billymosis/socialmedia-app/store/session"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
 )
 
-func ValidateJWT(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		head := r.Header.Get("Authorization")
-		if head == "" {
-			render.Unauthorized(w, errors.New("No header found"))
-			return
-		}
-		authHeader := strings.Split(head, "Bearer ")
-		if len(authHeader) != 2 {
-			render.Forbidden(w, errors.New("authorization not found in header"))
-			return
-		}
-		jwtToken := authHeader[1]
-		token, err := jwt.Parse(jwtToken, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+func ValidateJWT(ss *ss.SessionStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			head := r.Header.Get("Authorization")
+			if head == "" {
+				render.Unauthorized(w, errors.New("No header found"))
+				return
+			}
+			authHeader := strings.Split(head, "Bearer ")
+			if len(authHeader) != 2 {
+				render.Forbidden(w, errors.New("authorization not found in header"))
+				return
+			}
+			jwtToken := authHeader[1]
+			token, err := jwt.Parse(jwtToken, func(token *jwt.Token) (interface{}, error) {
+				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+				}
+				return []byte(os.Getenv("JWT_SECRET")), nil
+			})
+			if err != nil {
+				render.Forbidden(w, err)
+				return
 			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-		if err != nil {
-			render.Forbidden(w, err)
-			return
-		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			ctx := context.WithValue(r.Context(), "userAuthCtx", claims)
-			next.ServeHTTP(w, r.WithContext(ctx))
-			return
-		}
+			if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+				sessionId, _ := claims["sid"].(string)
+				if sessionId == "" {
+					render.Unauthorized(w, errors.New("session not found in token"))
+					return
+				}
+				active, err := ss.IsActive(r.Context(), sessionId)
+				if err != nil {
+					render.InternalError(w, err)
+					return
+				}
+				if !active {
+					render.Unauthorized(w, errors.New("session revoked"))
+					return
+				}
+				ctx := context.WithValue(r.Context(), "userAuthCtx", claims)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
 
-		http.Error(w, "err.Error()", http.StatusUnauthorized)
+			http.Error(w, "err.Error()", http.StatusUnauthorized)
 
-	},
-	)
+		},
+		)
+	}
 }
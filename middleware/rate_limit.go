@@ -0,0 +1,97 @@
+package AppMiddleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/handler/render"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	"github.com/billymosis/socialmedia-app/service/ratelimit"
+	"github.com/pkg/errors"
+)
+
+var errTooManyRequests = errors.New("too many requests")
+
+// KeyFunc picks the bucket a request is counted against. An empty key skips
+// the limit for that request.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP counts requests per client address. Deployments behind a proxy should
+// put chi's RealIP middleware in front so that RemoteAddr is the client.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByUser counts requests per authenticated user and falls back to the client
+// address for anonymous requests. It has to run after ValidateJWT.
+func KeyByUser(r *http.Request) string {
+	if userId, err := auth.GetUserId(r.Context()); err == nil {
+		return "user:" + strconv.Itoa(userId)
+	}
+	return "ip:" + KeyByIP(r)
+}
+
+// KeyByCredential counts requests per credentialValue in the JSON body, so that
+// guesses against one account are limited no matter how many addresses they
+// come from. The body is put back for the handler.
+func KeyByCredential(r *http.Request) string {
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var req struct {
+		CredentialValue string `json:"credentialValue"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(req.CredentialValue))
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// RateLimit allows rate requests per key for the routes it wraps. name
+// separates the buckets of different routes that share a store. Every response
+// carries RateLimit-* headers, rejected ones get 429 and Retry-After.
+func RateLimit(store ratelimit.Store, name string, rate ratelimit.Rate, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			res, err := store.Take(r.Context(), name+":"+k, rate)
+			if err != nil {
+				// A broken limiter backend should not take the API down.
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(rate.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", seconds(res.Reset))
+			if !res.Allowed {
+				w.Header().Set("Retry-After", seconds(res.RetryAfter))
+				render.ErrorCode(w, errTooManyRequests, http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
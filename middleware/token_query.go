@@ -0,0 +1,35 @@
+package AppMiddleware
+
+import "net/http"
+
+// TokenFromQuery lets clients that cannot set headers, like the browser
+// EventSource and WebSocket APIs, pass the access token as the access_token
+// query parameter on the given paths. ValidateJWT still does the actual
+// validation. The parameter is removed from the URL so that the token does not
+// end up in request logs; it has to run before the logger for that.
+func TokenFromQuery(paths ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		allowed[path] = struct{}{}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := allowed[r.URL.Path]; !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			query := r.URL.Query()
+			if !query.Has("access_token") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if token := query.Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			query.Del("access_token")
+			r.URL.RawQuery = query.Encode()
+			r.RequestURI = r.URL.RequestURI()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package model
+
+import "time"
+
+const (
+	ConversationRoleOwner  = "owner"
+	ConversationRoleAdmin  = "admin"
+	ConversationRoleMember = "member"
+)
+
+const (
+	MessageText = "text"
+	// System messages are written by the server when the membership of a
+	// group changes.
+	MessageGroupCreated  = "group_created"
+	MessageMemberAdded   = "member_added"
+	MessageMemberRemoved = "member_removed"
+	MessageMemberLeft    = "member_left"
+	MessageOwnerChanged  = "owner_changed"
+)
+
+type Conversation struct {
+	Id            int
+	IsGroup       bool
+	Title         *string
+	AvatarUrl     *string
+	LastMessageId *int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type GroupData struct {
+	Title     string
+	AvatarUrl *string
+	MemberIds []int
+}
+
+type GroupUpdate struct {
+	Title     *string
+	AvatarUrl *string
+}
+
+type Message struct {
+	Id             int
+	ConversationId int
+	SenderId       int
+	Kind           string
+	TargetUserId   *int
+	Body           string
+	CreatedAt      time.Time
+}
+
+type MessageResponseData struct {
+	MessageId      string    `json:"messageId"`
+	ConversationId string    `json:"conversationId"`
+	SenderId       string    `json:"senderId"`
+	Type           string    `json:"type"`
+	TargetUserId   *string   `json:"targetUserId,omitempty"`
+	Message        string    `json:"message"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// ConversationMember carries the read receipt of a participant: every message up
+// to LastReadMessageId has been seen by them.
+type ConversationMember struct {
+	CreatorValid
+	Role              string     `json:"role"`
+	LastReadMessageId string     `json:"lastReadMessageId"`
+	LastReadAt        *time.Time `json:"lastReadAt"`
+}
+
+type ConversationResponseData struct {
+	ConversationId string               `json:"conversationId"`
+	IsGroup        bool                 `json:"isGroup"`
+	Title          *string              `json:"title"`
+	AvatarUrl      *string              `json:"avatarUrl"`
+	Members        []ConversationMember `json:"members"`
+	LastMessage    *MessageResponseData `json:"lastMessage"`
+	UnreadCount    int                  `json:"unreadCount"`
+	MutedUntil     *time.Time           `json:"mutedUntil"`
+	CreatedAt      time.Time            `json:"createdAt"`
+	UpdatedAt      time.Time            `json:"updatedAt"`
+}
+
+type ConversationListResponse struct {
+	Message string                     `json:"message"`
+	Data    []ConversationResponseData `json:"data"`
+	Meta    CursorMeta                 `json:"meta"`
+}
+
+type MessageListResponse struct {
+	Message string                `json:"message"`
+	Data    []MessageResponseData `json:"data"`
+	Meta    CursorMeta            `json:"meta"`
+}
@@ -1,8 +1,18 @@
 package model
 
+import "time"
+
+const (
+	CodePasswordReset    = "password_reset"
+	CodeVerifyCredential = "verify_credential"
+	CredentialTypeEmail  = "email"
+	CredentialTypePhone  = "phone"
+)
+
 type Credential struct {
 	Id              int
 	CredentialType  string
 	CredentialValue string
 	UserId          int
+	VerifiedAt      *time.Time
 }
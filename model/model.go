@@ -14,3 +14,7 @@ type Meta struct {
 	Total  int `json:"total"`
 }
 
+type CursorMeta struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
@@ -0,0 +1,60 @@
+package model
+
+import "time"
+
+const (
+	NotificationComment        = "comment"
+	NotificationReply          = "reply"
+	NotificationReaction       = "reaction"
+	NotificationCommentReact   = "comment_reaction"
+	NotificationFriendRequest  = "friend_request"
+	NotificationFriendAccept   = "friend_accept"
+	NotificationMention        = "mention"
+	NotificationCommentMention = "comment_mention"
+	NotificationFollow         = "follow"
+	NotificationFollowRequest  = "follow_request"
+	NotificationFollowAccept   = "follow_accept"
+)
+
+// NotificationEvent is something that happened to UserId because of ActorId.
+// Events of the same type on the same target are grouped until they are read.
+type NotificationEvent struct {
+	UserId   int
+	ActorId  int
+	Type     string
+	TargetId int
+}
+
+type Notification struct {
+	Id         int
+	UserId     int
+	Type       string
+	TargetId   int
+	ActorCount int
+	ReadAt     *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type NotificationResponseData struct {
+	NotificationId string         `json:"notificationId"`
+	Type           string         `json:"type"`
+	TargetId       string         `json:"targetId"`
+	Message        string         `json:"message"`
+	ActorCount     int            `json:"actorCount"`
+	Actors         []CreatorValid `json:"actors"`
+	Read           bool           `json:"read"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+}
+
+type NotificationMeta struct {
+	CursorMeta
+	UnreadCount int `json:"unreadCount"`
+}
+
+type NotificationResponse struct {
+	Message string                     `json:"message"`
+	Data    []NotificationResponseData `json:"data"`
+	Meta    NotificationMeta           `json:"meta"`
+}
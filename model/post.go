@@ -6,26 +6,43 @@ import (
 
 )
 
+const (
+	VisibilityPublic  = "public"
+	VisibilityFriends = "friends"
+	VisibilityPrivate = "private"
+)
+
 type Post struct {
-	Id        int
-	Html      string
-	UserId    int
-	Tags      []string
-	CreatedAt time.Time
+	Id         int
+	Html       string
+	UserId     int
+	Tags       []string
+	Visibility string
+	CreatedAt  time.Time
+}
+
+type PostUpdate struct {
+	Html       *string
+	Tags       []string
+	Visibility *string
 }
 
 type Comment struct {
-	Id        int
-	Comment   string
-	PostId    int
-	UserId    int
-	CreatedAt time.Time
+	Id              int
+	Comment         string
+	PostId          int
+	UserId          int
+	ParentCommentId *int
+	CreatedAt       time.Time
+	UpdatedAt       *time.Time
 }
 
 type PostData struct {
-	PostInHTML string    `json:"postInHtml"`
-	Tags       []string  `json:"tags"`
-	CreatedAt  time.Time `json:"createdAt"`
+	PostInHTML string     `json:"postInHtml"`
+	Tags       []string   `json:"tags"`
+	Visibility string     `json:"visibility"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
 }
 
 type CommentResponse struct {
@@ -35,16 +52,26 @@ type CommentResponse struct {
 }
 
 type CommentResponseValid struct {
-	Comment   string       `json:"comment"`
-	Creator   CreatorValid `json:"creator"`
-	CreatedAt time.Time    `json:"createdAt"`
+	CommentId       string                 `json:"commentId"`
+	ParentCommentId *string                `json:"parentCommentId"`
+	Comment         string                 `json:"comment"`
+	Creator         CreatorValid           `json:"creator"`
+	Reactions       map[string]int         `json:"reactions"`
+	MyReaction      *string                `json:"myReaction"`
+	CreatedAt       time.Time              `json:"createdAt"`
+	UpdatedAt       *time.Time             `json:"updatedAt,omitempty"`
+	Replies         []CommentResponseValid `json:"replies,omitempty"`
 }
 
 type PostResponseData struct {
-	PostID      string                 `json:"postId"`
-	PostContent PostData               `json:"post"`
-	Comments    []CommentResponseValid `json:"comments"`
-	Creator     CreatorValid           `json:"creator"`
+	PostID       string                 `json:"postId"`
+	PostContent  PostData               `json:"post"`
+	Comments     []CommentResponseValid `json:"comments"`
+	CommentCount int                    `json:"commentCount"`
+	Creator      CreatorValid           `json:"creator"`
+	Reactions    map[string]int         `json:"reactions"`
+	MyReaction   *string                `json:"myReaction"`
+	Highlight    *string                `json:"highlight,omitempty"`
 }
 
 type Creator struct {
@@ -61,11 +88,13 @@ type CreatorValid struct {
 	ImageURL    string    `json:"imageUrl"`
 	FriendCount int       `json:"friendCount"`
 	CreatedAt   time.Time `json:"createdAt"`
+	Relation
 }
 
 type CommentAndUser struct {
-	Comment Comment
-	Creator CreatorValid
+	Comment   Comment
+	Creator   CreatorValid
+	Reactions map[string]int
 }
 
 type PostResponse struct {
@@ -73,3 +102,14 @@ type PostResponse struct {
 	Data    []PostResponseData `json:"data"`
 	Meta    Meta               `json:"meta"`
 }
+
+type PostDetailResponse struct {
+	Message string           `json:"message"`
+	Data    PostResponseData `json:"data"`
+}
+
+type CommentListResponse struct {
+	Message string                 `json:"message"`
+	Data    []CommentResponseValid `json:"data"`
+	Meta    CursorMeta             `json:"meta"`
+}
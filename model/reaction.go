@@ -0,0 +1,30 @@
+package model
+
+const (
+	ReactionLike  = "like"
+	ReactionLove  = "love"
+	ReactionHaha  = "haha"
+	ReactionWow   = "wow"
+	ReactionSad   = "sad"
+	ReactionAngry = "angry"
+)
+
+var ReactionKinds = []string{
+	ReactionLike,
+	ReactionLove,
+	ReactionHaha,
+	ReactionWow,
+	ReactionSad,
+	ReactionAngry,
+}
+
+type Reaction struct {
+	TargetId int
+	UserId   int
+	Kind     string
+}
+
+type ReactionSummary struct {
+	Counts map[string]int `json:"counts"`
+	Mine   *string        `json:"mine"`
+}
@@ -1,7 +1,30 @@
 package model
 
+import "time"
+
+const (
+	FriendRequestPending   = "pending"
+	FriendRequestAccepted  = "accepted"
+	FriendRequestRejected  = "rejected"
+	FriendRequestCancelled = "cancelled"
+)
+
+const (
+	FollowPending  = "pending"
+	FollowAccepted = "accepted"
+)
+
 type Relationship struct {
 	Id           int
 	UserFirstId  int
 	UserSecondId int
 }
+
+type FriendRequest struct {
+	Id          int
+	SenderId    int
+	ReceiverId  int
+	Status      string
+	CreatedAt   time.Time
+	RespondedAt *time.Time
+}
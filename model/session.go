@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+type Session struct {
+	Id        string
+	UserId    int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
@@ -20,6 +20,65 @@ type User struct {
 	ImageUrl    string
 	CreatedAt   time.Time
 	FriendCount int
+	FollowCounts
+	Profile
+	Discovery
+	HandleChangedAt       *time.Time
+	FollowersNeedApproval bool
+}
+
+// FollowCounts are kept next to friend_count. Pending follows are not counted.
+type FollowCounts struct {
+	FollowerCount  int `json:"followerCount"`
+	FollowingCount int `json:"followingCount"`
+}
+
+// Profile holds what users write about themselves. Handle is nil until the
+// user picks one.
+type Profile struct {
+	Handle   *string `json:"handle"`
+	Bio      string  `json:"bio"`
+	Website  string  `json:"website"`
+	Location string  `json:"location"`
+}
+
+// How the signed in user relates to another user, from their side.
+const (
+	RelationshipSelf            = "self"
+	RelationshipFriend          = "friend"
+	RelationshipPendingOutgoing = "pending_outgoing"
+	RelationshipPendingIncoming = "pending_incoming"
+	RelationshipBlocked         = "blocked"
+	RelationshipNone            = "none"
+)
+
+// Relation is how the signed in user relates to a user shown to them, and how
+// many friends they have in common.
+type Relation struct {
+	Relationship string `json:"relationship"`
+	MutualCount  int    `json:"mutualCount"`
+}
+
+// Discovery tells whether other users may find someone by their verified email
+// address or phone number. Both are off until the user turns them on.
+type Discovery struct {
+	ByEmail bool `json:"discoverableByEmail"`
+	ByPhone bool `json:"discoverableByPhone"`
+}
+
+// UserUpdate changes the fields that are not nil. Empty strings clear the
+// optional ones.
+type UserUpdate struct {
+	Name     *string
+	ImageUrl *string
+	Handle   *string
+	Bio      *string
+	Website  *string
+	Location *string
+
+	DiscoverableByEmail   *bool
+	DiscoverableByPhone   *bool
+	FollowersNeedApproval *bool
 }
 
 type UserAndCred struct {
@@ -33,6 +92,35 @@ type UserAndCred struct {
 	Phone       string
 }
 
+// UserProfile is what signed in users see of each other.
+type UserProfile struct {
+	CreatorValid
+	Profile
+	FollowCounts
+	// Follow is the status of the viewer's follow of this user, empty when
+	// they do not follow them.
+	Follow string `json:"follow"`
+}
+
+type AccountCredential struct {
+	CredentialType  string     `json:"credentialType"`
+	CredentialValue string     `json:"credentialValue"`
+	Verified        bool       `json:"verified"`
+	VerifiedAt      *time.Time `json:"verifiedAt"`
+}
+
+// Account is everything users see of themselves.
+type Account struct {
+	CreatorValid
+	Profile
+	Discovery
+	FollowCounts
+	FollowersNeedApproval bool                `json:"followersNeedApproval"`
+	HandleChangedAt       *time.Time          `json:"handleChangedAt"`
+	Credentials           []AccountCredential `json:"credentials"`
+	TwoFactorEnabled      bool                `json:"twoFactorEnabled"`
+}
+
 func (user *User) HashPassword() error {
 	saltRound, err := strconv.Atoi(os.Getenv("BCRYPT_SALT"))
 	if err != nil {
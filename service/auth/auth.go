@@ -2,7 +2,13 @@ package auth
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"math/big"
 	"os"
 	"strconv"
 	"time"
@@ -10,12 +16,20 @@ import (
 	"github.com/dgrijalva/jwt-go"
 )
 
+const RefreshTokenLifetime = time.Hour * 24 * 30
+
 type jwtCustomClaims struct {
-	UserId int `json:"user_id"`
+	UserId    int    `json:"user_id"`
+	SessionId string `json:"sid"`
 	jwt.StandardClaims
 }
 
-func GenerateToken(id int) (string, error) {
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+func GenerateToken(id int, sessionId string) (string, error) {
 	now := time.Now()
 	var expiration time.Time
 	environment := os.Getenv("ENVIRONMENT")
@@ -25,7 +39,8 @@ func GenerateToken(id int) (string, error) {
 		expiration = now.Add(time.Hour * 1)
 	}
 	claims := &jwtCustomClaims{
-		UserId: id,
+		UserId:    id,
+		SessionId: sessionId,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expiration.Unix(),
 		},
@@ -41,6 +56,40 @@ func GenerateToken(id int) (string, error) {
 	return t, nil
 }
 
+// GenerateRefreshToken returns an opaque random token together with the hash
+// that is persisted. Only the hash is ever stored server side.
+func GenerateRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateCode returns a random six digit one-time code and the hash that is
+// persisted. Codes are short, so the hash is keyed with the server secret to
+// keep a leaked table from being brute forced offline.
+func GenerateCode() (string, string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	return code, HashCode(code), nil
+}
+
+func HashCode(code string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET")))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func GetUserId(ctx context.Context) (int, error) {
 	props, _ := ctx.Value("userAuthCtx").(jwt.MapClaims)
 
@@ -51,3 +100,14 @@ func GetUserId(ctx context.Context) (int, error) {
 
 	return userId, nil
 }
+
+func GetSessionId(ctx context.Context) (string, error) {
+	props, _ := ctx.Value("userAuthCtx").(jwt.MapClaims)
+
+	sessionId, ok := props["sid"].(string)
+	if !ok || sessionId == "" {
+		return "", fmt.Errorf("session not found in token")
+	}
+
+	return sessionId, nil
+}
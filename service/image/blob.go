@@ -0,0 +1,21 @@
+package image
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// BlobStore persists uploaded files and returns the URL they are served from.
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error)
+	// Owns tells whether url is one Put hands out, so that content can only
+	// point at uploaded files.
+	Owns(url string) bool
+}
+
+// ownsURL tells whether url names an object right below baseURL.
+func ownsURL(baseURL string, url string) bool {
+	key, ok := strings.CutPrefix(url, baseURL+"/")
+	return ok && key != "" && !strings.ContainsAny(key, "?#\\") && !strings.Contains(key, "..")
+}
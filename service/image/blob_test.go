@@ -0,0 +1,27 @@
+package image
+
+import "testing"
+
+func TestOwns(t *testing.T) {
+	store := NewMemoryBlobStore("https://cdn.example/media/")
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://cdn.example/media/a.png", want: true},
+		{url: "https://cdn.example/media/", want: false},
+		{url: "https://cdn.example/media", want: false},
+		{url: "https://cdn.example/mediax/a.png", want: false},
+		{url: "https://cdn.example/media/../a.png", want: false},
+		{url: "https://cdn.example/media/a.png?track=1", want: false},
+		{url: "https://evil.example/media/a.png", want: false},
+		{url: "https://evil.example/?https://cdn.example/media/a.png", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := store.Owns(tt.url); got != tt.want {
+				t.Fatalf("Owns(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,31 +1,17 @@
 package image
 
 import (
+	"bytes"
 	"errors"
-	"fmt"
+	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/billymosis/socialmedia-app/handler/render"
 	"github.com/google/uuid"
 )
 
-func isValidFile(filename string) bool {
-	allowedExtensions := []string{".jpg", ".jpeg"}
-	ext := strings.ToLower(filepath.Ext(filename))
-	for _, validExt := range allowedExtensions {
-		if ext == validExt {
-			return true
-		}
-	}
-	return false
-}
-
 func isValidFileSize(fileSize int64) bool {
 	return fileSize >= 10*1024 && fileSize <= 2*1024*1024
 }
@@ -33,11 +19,12 @@ func isValidFileSize(fileSize int64) bool {
 type uploadResponse struct {
 	Message string `json:"message"`
 	Data    struct {
-		ImageUrl string `json:"imageUrl"`
+		ImageUrl   string            `json:"imageUrl"`
+		Thumbnails map[string]string `json:"thumbnails"`
 	} `json:"data"`
 }
 
-func Upload(client *s3.Client) http.HandlerFunc {
+func Upload(store BlobStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
@@ -46,7 +33,7 @@ func Upload(client *s3.Client) http.HandlerFunc {
 		}
 
 		r.Body = http.MaxBytesReader(w, r.Body, 2*1024*1024)
-		file, handler, err := r.FormFile("file")
+		file, header, err := r.FormFile("file")
 		if file == nil {
 			render.ErrorCode(w, errors.New("empty"), 400)
 			return
@@ -57,39 +44,48 @@ func Upload(client *s3.Client) http.HandlerFunc {
 		}
 		defer file.Close()
 
-		if !isValidFile(handler.Filename) {
-			http.Error(w, "Invalid file format. Must be *.jpg or *.jpeg", http.StatusBadRequest)
+		if !isValidFileSize(header.Size) {
+			http.Error(w, "File size must be between 10KB and 2MB", http.StatusBadRequest)
 			return
 		}
 
-		if !isValidFileSize(handler.Size) {
-			http.Error(w, "File size must be between 10KB and 2MB", http.StatusBadRequest)
+		data, err := io.ReadAll(file)
+		if err != nil {
+			render.BadRequest(w, err)
 			return
 		}
 
-		filename := uuid.New().String() + filepath.Ext(handler.Filename)
-		sess := s3.New(client.Options())
-
-		bucket := os.Getenv("S3_BUCKET_NAME")
-		_, err = sess.PutObject(r.Context(),
-			&s3.PutObjectInput{
-				Bucket: aws.String(bucket),
-				Key:    aws.String(filename),
-				ACL:    types.ObjectCannedACL(*aws.String("public-read")),
-				Body:   file,
-			})
+		processed, err := Process(data)
 		if err != nil {
+			if errors.Is(err, errUnsupportedType) || errors.Is(err, errImageTooLarge) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			render.InternalError(w, err)
 			return
 		}
 
-		url := fmt.Sprintf("https://%s.%s/%s", bucket, "s3.amazonaws.com", filename)
+		var res uploadResponse
+		res.Message = "File uploaded successfully"
+		res.Data.Thumbnails = make(map[string]string, len(processed.Thumbnails))
+
+		name := uuid.New().String()
+		original := processed.Original
+		res.Data.ImageUrl, err = store.Put(r.Context(), name+original.Ext, bytes.NewReader(original.Data), original.ContentType)
+		if err != nil {
+			render.InternalError(w, err)
+			return
+		}
+		for size, thumb := range processed.Thumbnails {
+			key := name + "_" + strconv.Itoa(size) + thumb.Ext
+			url, err := store.Put(r.Context(), key, bytes.NewReader(thumb.Data), thumb.ContentType)
+			if err != nil {
+				render.InternalError(w, err)
+				return
+			}
+			res.Data.Thumbnails[strconv.Itoa(size)] = url
+		}
 
-		render.JSON(w, uploadResponse{
-			Message: "File uploaded successfully",
-			Data: struct {
-				ImageUrl string `json:"imageUrl"`
-			}{ImageUrl: url},
-		}, 200)
+		render.JSON(w, res, 200)
 	}
 }
@@ -0,0 +1,65 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryObject struct {
+	contentType string
+	data        []byte
+}
+
+// MemoryBlobStore keeps objects in memory. It is meant for tests and local
+// runs where nothing has to survive a restart.
+type MemoryBlobStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+	baseURL string
+}
+
+func NewMemoryBlobStore(baseURL string) *MemoryBlobStore {
+	return &MemoryBlobStore{
+		objects: make(map[string]memoryObject),
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (s *MemoryBlobStore) Owns(url string) bool {
+	return ownsURL(s.baseURL, url)
+}
+
+func (s *MemoryBlobStore) Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.objects[key] = memoryObject{contentType: contentType, data: data}
+	s.mu.Unlock()
+	return s.baseURL + "/" + key, nil
+}
+
+func (s *MemoryBlobStore) Get(key string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[key]
+	return obj.data, ok
+}
+
+func (s *MemoryBlobStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	obj, ok := s.objects[strings.TrimPrefix(r.URL.Path, "/")]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", obj.contentType)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(obj.data))
+}
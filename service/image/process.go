@@ -0,0 +1,136 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	maxPixels   = 40_000_000
+	jpegQuality = 85
+)
+
+// ThumbnailSizes are the longest-edge sizes, in pixels, generated for every
+// upload. Images smaller than a size are never scaled up.
+var ThumbnailSizes = []int{64, 256, 1024}
+
+var (
+	errUnsupportedType = errors.New("Invalid file format. Must be a JPEG, PNG or WebP image")
+	errImageTooLarge   = errors.New("Image dimensions are too large")
+)
+
+type Encoded struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+}
+
+type Processed struct {
+	Original   Encoded
+	Thumbnails map[int]Encoded
+}
+
+// sniff detects the image type from its leading bytes rather than trusting the
+// client supplied filename.
+func sniff(data []byte) (string, error) {
+	switch contentType := http.DetectContentType(data); contentType {
+	case "image/jpeg", "image/png", "image/webp":
+		return contentType, nil
+	default:
+		return "", errUnsupportedType
+	}
+}
+
+// Process decodes an uploaded image, normalises its orientation and re-encodes
+// it together with its thumbnails. Re-encoding drops every metadata block, so
+// EXIF and GPS data never reach storage.
+func Process(data []byte) (*Processed, error) {
+	contentType, err := sniff(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errUnsupportedType
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, errImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errUnsupportedType
+	}
+	if contentType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	// There is no WebP encoder in the standard library, so WebP uploads are
+	// stored as PNG when they carry transparency and as JPEG otherwise.
+	usePNG := contentType == "image/png" || (contentType == "image/webp" && !isOpaque(img))
+
+	original, err := encode(img, usePNG)
+	if err != nil {
+		return nil, err
+	}
+	res := Processed{
+		Original:   original,
+		Thumbnails: make(map[int]Encoded, len(ThumbnailSizes)),
+	}
+	for _, size := range ThumbnailSizes {
+		thumb, err := encode(resize(img, size), usePNG)
+		if err != nil {
+			return nil, err
+		}
+		res.Thumbnails[size] = thumb
+	}
+	return &res, nil
+}
+
+func encode(img image.Image, usePNG bool) (Encoded, error) {
+	var buf bytes.Buffer
+	if usePNG {
+		if err := png.Encode(&buf, img); err != nil {
+			return Encoded{}, err
+		}
+		return Encoded{Data: buf.Bytes(), ContentType: "image/png", Ext: ".png"}, nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return Encoded{}, err
+	}
+	return Encoded{Data: buf.Bytes(), ContentType: "image/jpeg", Ext: ".jpg"}, nil
+}
+
+// resize scales img so that its longest edge is at most size pixels.
+func resize(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	if w >= h {
+		h = max(1, h*size/w)
+		w = size
+	} else {
+		w = max(1, w*size/h)
+		h = size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type S3BlobStore struct {
+	client  *s3.Client
+	bucket  string
+	baseURL string
+}
+
+// NewS3BlobStore stores objects in bucket. When baseURL is empty objects are
+// addressed through the public s3.amazonaws.com host.
+func NewS3BlobStore(client *s3.Client, bucket string, baseURL string) *S3BlobStore {
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://%s.%s", bucket, "s3.amazonaws.com")
+	}
+	return &S3BlobStore{
+		client:  client,
+		bucket:  bucket,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (s *S3BlobStore) Owns(url string) bool {
+	return ownsURL(s.baseURL, url)
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error) {
+	_, err := s.client.PutObject(ctx,
+		&s3.PutObjectInput{
+			Bucket:      aws.String(s.bucket),
+			Key:         aws.String(key),
+			ACL:         types.ObjectCannedACLPublicRead,
+			ContentType: aws.String(contentType),
+			Body:        body,
+		})
+	if err != nil {
+		return "", err
+	}
+	return s.baseURL + "/" + key, nil
+}
@@ -0,0 +1,165 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newServer mounts Upload and the media route of store the way the API does.
+func newServer(t *testing.T, store BlobStore) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/upload", Upload(store))
+	mux.Handle("/media/", http.StripPrefix("/media/", store.(http.Handler)))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// noisePNG returns a PNG that does not compress below the minimum upload size.
+func noisePNG(t *testing.T) []byte {
+	t.Helper()
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, 120, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			img.Set(x, y, color.RGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func upload(t *testing.T, srv *httptest.Server, data []byte) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "upload.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	res, err := http.Post(srv.URL+"/upload", form.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestUploadRoundTrip(t *testing.T) {
+	store := NewMemoryBlobStore("/media")
+	srv := newServer(t, store)
+
+	res := upload(t, srv, noisePNG(t))
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(res.Body)
+		t.Fatalf("upload status = %d: %s", res.StatusCode, msg)
+	}
+	var uploaded uploadResponse
+	if err := json.NewDecoder(res.Body).Decode(&uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded.Data.Thumbnails) != len(ThumbnailSizes) {
+		t.Fatalf("got %d thumbnails, want %d", len(uploaded.Data.Thumbnails), len(ThumbnailSizes))
+	}
+
+	urls := []string{uploaded.Data.ImageUrl}
+	for _, url := range uploaded.Data.Thumbnails {
+		urls = append(urls, url)
+	}
+	for _, url := range urls {
+		stored, ok := store.Get(strings.TrimPrefix(url, "/media/"))
+		if !ok {
+			t.Fatalf("%s was not stored", url)
+		}
+		res, err := http.Get(srv.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		served, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s status = %d", url, res.StatusCode)
+		}
+		if got := res.Header.Get("Content-Type"); got != "image/png" {
+			t.Fatalf("GET %s Content-Type = %q, want image/png", url, got)
+		}
+		if !bytes.Equal(served, stored) {
+			t.Fatalf("GET %s did not serve the stored object", url)
+		}
+	}
+}
+
+func TestUploadRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "too small", data: []byte("tiny")},
+		{name: "not an image", data: bytes.Repeat([]byte("plain text "), 2000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryBlobStore("/media")
+			srv := newServer(t, store)
+
+			res := upload(t, srv, tt.data)
+			if res.StatusCode != http.StatusBadRequest {
+				t.Fatalf("upload status = %d, want %d", res.StatusCode, http.StatusBadRequest)
+			}
+			if len(store.objects) != 0 {
+				t.Fatalf("stored %d objects, want none", len(store.objects))
+			}
+		})
+	}
+}
+
+func TestLocalBlobStoreHidesDirectories(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put(context.Background(), "a/b.png", bytes.NewReader(noisePNG(t)), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(t, store)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/media/a/b.png", want: http.StatusOK},
+		{path: "/media/", want: http.StatusNotFound},
+		{path: "/media/a", want: http.StatusNotFound},
+		{path: "/media/a/", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, err := http.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.want {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, res.StatusCode, tt.want)
+			}
+		})
+	}
+}
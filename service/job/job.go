@@ -0,0 +1,32 @@
+// Package job runs background work periodically inside the API process.
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Every runs fn right away and then every interval until ctx is done. A failed
+// run is logged and the next one happens on schedule, and runs never overlap.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		err := fn(ctx)
+		fields := logrus.Fields{"job": name, "duration": time.Since(start)}
+		switch {
+		case err == nil:
+			logrus.WithFields(fields).Info("job finished")
+		case ctx.Err() == nil:
+			logrus.WithFields(fields).WithError(err).Error("job failed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package markup finds @mentions and #hashtags in user content and turns them
+// into links.
+package markup
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// The character before a token must not continue a word, so that e-mail
+	// addresses, URL fragments and HTML entities are left alone.
+	mentionPattern = regexp.MustCompile(`(^|[^A-Za-z0-9_@/.])@([A-Za-z0-9_]{3,30})`)
+	hashtagPattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_#&/])#([\p{L}\p{N}_]{1,50})`)
+)
+
+// token is a mention or hashtag found at text[start:end], value is without the
+// leading @ or #.
+type token struct {
+	start, end int
+	mention    bool
+	value      string
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+func hasLetter(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokens returns the mentions and hashtags of text in order.
+func tokens(text string) []token {
+	var found []token
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		// A handle running on past its maximum length is not a handle.
+		if m[5] < len(text) && isWordByte(text[m[5]]) {
+			continue
+		}
+		found = append(found, token{m[4] - 1, m[5], true, text[m[4]:m[5]]})
+	}
+	for _, m := range hashtagPattern.FindAllStringSubmatchIndex(text, -1) {
+		value := text[m[4]:m[5]]
+		if !hasLetter(value) {
+			continue
+		}
+		t := token{m[4] - 1, m[5], false, value}
+		i := len(found)
+		for i > 0 && found[i-1].start > t.start {
+			i--
+		}
+		found = append(found[:i], append([]token{t}, found[i:]...)...)
+	}
+	return found
+}
+
+func appendUnique(list []string, seen map[string]bool, value string) []string {
+	if seen[value] {
+		return list
+	}
+	seen[value] = true
+	return append(list, value)
+}
+
+// skipped are elements whose text is not prose. Nothing in them is a mention
+// or a hashtag.
+var skipped = map[string]bool{
+	"code":   true,
+	"pre":    true,
+	"script": true,
+	"style":  true,
+}
+
+// walk calls text for every text node of src outside skipped elements and puts
+// what it returns in place of the node. inLink tells whether the node is inside
+// a link already. Everything else is copied as it is.
+func walk(src string, text func(raw string, unescaped string, inLink bool) string) string {
+	z := html.NewTokenizer(strings.NewReader(src))
+	var b strings.Builder
+	skipDepth, linkDepth := 0, 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return b.String()
+		}
+		raw := string(z.Raw())
+		switch tt {
+		case html.TextToken:
+			if skipDepth > 0 {
+				b.WriteString(raw)
+				continue
+			}
+			b.WriteString(text(raw, string(z.Text()), linkDepth > 0))
+		case html.StartTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			delta := 1
+			if tt == html.EndTagToken {
+				delta = -1
+			}
+			if skipped[string(name)] {
+				skipDepth = max(skipDepth+delta, 0)
+			}
+			if string(name) == "a" {
+				linkDepth = max(linkDepth+delta, 0)
+			}
+			b.WriteString(raw)
+		default:
+			b.WriteString(raw)
+		}
+	}
+}
+
+// Extract returns the handles mentioned and the hashtags used in the text of
+// an HTML document, lower cased and without duplicates. Mentions that are
+// already links count too, so that extracting from linked HTML gives the same
+// result.
+func Extract(src string) (mentions []string, hashtags []string) {
+	mentions, hashtags = make([]string, 0), make([]string, 0)
+	seenMentions, seenHashtags := make(map[string]bool), make(map[string]bool)
+	walk(src, func(raw string, text string, inLink bool) string {
+		for _, t := range tokens(text) {
+			if t.mention {
+				mentions = appendUnique(mentions, seenMentions, strings.ToLower(t.value))
+			} else {
+				hashtags = appendUnique(hashtags, seenHashtags, strings.ToLower(t.value))
+			}
+		}
+		return raw
+	})
+	return mentions, hashtags
+}
+
+// MentionURL and HashtagURL are where the links made by Link point to.
+func MentionURL(handle string) string {
+	return "/@" + url.PathEscape(handle)
+}
+
+func HashtagURL(tag string) string {
+	return "/hashtag/" + url.PathEscape(strings.ToLower(tag))
+}
+
+// Link turns the hashtags, and the mentions of handles in known, in the text of
+// an HTML document into links. known holds lower cased handles. Text that is
+// already inside a link is left alone.
+func Link(src string, known map[string]int) string {
+	return walk(src, func(raw string, text string, inLink bool) string {
+		if inLink {
+			return raw
+		}
+		found := tokens(text)
+		var b strings.Builder
+		last := 0
+		for _, t := range found {
+			if t.mention {
+				if _, ok := known[strings.ToLower(t.value)]; !ok {
+					continue
+				}
+			}
+			b.WriteString(html.EscapeString(text[last:t.start]))
+			if t.mention {
+				b.WriteString(`<a href="` + html.EscapeString(MentionURL(t.value)) + `" class="mention">`)
+			} else {
+				b.WriteString(`<a href="` + html.EscapeString(HashtagURL(t.value)) + `" class="hashtag">`)
+			}
+			b.WriteString(html.EscapeString(text[t.start:t.end]))
+			b.WriteString("</a>")
+			last = t.end
+		}
+		if last == 0 {
+			return raw
+		}
+		b.WriteString(html.EscapeString(text[last:]))
+		return b.String()
+	})
+}
@@ -0,0 +1,159 @@
+package markup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []token
+	}{
+		{
+			name: "mention and hashtag",
+			text: "hi @bob and #go",
+			want: []token{{3, 7, true, "bob"}, {12, 15, false, "go"}},
+		},
+		{
+			name: "email addresses and URLs",
+			text: "mail bob@example.com or x.com/@bob",
+		},
+		{
+			name: "handle length",
+			text: "@ab @abcdefghijklmnopqrstuvwxyz1234 @abcdefghijklmnopqrstuvwxyz12345",
+			want: []token{{4, 35, true, "abcdefghijklmnopqrstuvwxyz1234"}},
+		},
+		{
+			name: "trailing punctuation",
+			text: "@bob, #go! (#rust) @bob.",
+			want: []token{{0, 4, true, "bob"}, {6, 9, false, "go"}, {12, 17, false, "rust"}, {19, 23, true, "bob"}},
+		},
+		{
+			name: "hashtags need a letter and a break before them",
+			text: "#123 #a1 &#35;x a#b ##x",
+			want: []token{{5, 8, false, "a1"}},
+		},
+		{
+			name: "unicode and case",
+			text: "#Café @Bob_1",
+			want: []token{{0, 6, false, "Café"}, {7, 13, true, "Bob_1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokens(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("tokens(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		mentions []string
+		hashtags []string
+	}{
+		{
+			name:     "text",
+			src:      `<p>hi @Bob #Go @bob #go</p>`,
+			mentions: []string{"bob"},
+			hashtags: []string{"go"},
+		},
+		{
+			name:     "attributes and code",
+			src:      `<p><a href="https://x.example/@bob">@carol</a> <code>@dave #x</code> <img alt="@erin"></p>`,
+			mentions: []string{"carol"},
+			hashtags: []string{},
+		},
+		{
+			name:     "entities",
+			src:      `<p>&#64;erin &amp;#35;y @frank&lt;</p>`,
+			mentions: []string{"erin", "frank"},
+			hashtags: []string{},
+		},
+		{
+			name:     "already linked",
+			src:      `<a href="/@bob" class="mention">@bob</a> <a href="/hashtag/go" class="hashtag">#go</a>`,
+			mentions: []string{"bob"},
+			hashtags: []string{"go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mentions, hashtags := Extract(tt.src)
+			if !reflect.DeepEqual(mentions, tt.mentions) || !reflect.DeepEqual(hashtags, tt.hashtags) {
+				t.Fatalf("Extract(%q) = %q, %q, want %q, %q", tt.src, mentions, hashtags, tt.mentions, tt.hashtags)
+			}
+		})
+	}
+}
+
+func TestLink(t *testing.T) {
+	known := map[string]int{"bob": 1, "erin": 2, "frank": 3}
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "known mention and hashtag",
+			src:  `<p>hi @Bob #go</p>`,
+			want: `<p>hi <a href="/@Bob" class="mention">@Bob</a> <a href="/hashtag/go" class="hashtag">#go</a></p>`,
+		},
+		{
+			name: "unknown mention",
+			src:  `<p>hi @carol</p>`,
+			want: `<p>hi @carol</p>`,
+		},
+		{
+			name: "inside links and code",
+			src:  `<p><a href="https://x.example/@bob">@bob</a> <code>@bob #x</code></p>`,
+			want: `<p><a href="https://x.example/@bob">@bob</a> <code>@bob #x</code></p>`,
+		},
+		{
+			name: "entities",
+			src:  `<p>&#64;erin &amp;#35;y @frank&lt;</p>`,
+			want: `<p><a href="/@erin" class="mention">@erin</a> &amp;#35;y <a href="/@frank" class="mention">@frank</a>&lt;</p>`,
+		},
+		{
+			name: "email address",
+			src:  `<p>bob@example.com</p>`,
+			want: `<p>bob@example.com</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Link(tt.src, known)
+			if got != tt.want {
+				t.Fatalf("Link(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+			if again := Link(got, known); again != got {
+				t.Fatalf("Link is not idempotent for %q: %q then %q", tt.src, got, again)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{src: `<p>one</p><p>two</p>`, want: "one two"},
+		{src: `<b>bo</b>ld <a href="/@bob">@bob</a>`, want: "bold @bob"},
+		{src: `a &amp; b&nbsp;c`, want: "a & b c"},
+		{src: `x<script>y</script>z`, want: "x z"},
+		{src: "<p>a\tb\x01c</p><br>d", want: "a b c d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			if got := Text(tt.src); got != tt.want {
+				t.Fatalf("Text(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
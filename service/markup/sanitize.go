@@ -0,0 +1,221 @@
+package markup
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowed lists the elements user content may use and the attributes each of
+// them may carry. Anything else is dropped, and the text of unknown elements
+// is kept.
+var allowed = map[string]map[string]bool{
+	"a":          {"href": true, "title": true, "class": true},
+	"b":          {},
+	"blockquote": {},
+	"br":         {},
+	"code":       {},
+	"del":        {},
+	"em":         {},
+	"h1":         {},
+	"h2":         {},
+	"h3":         {},
+	"hr":         {},
+	"i":          {},
+	"img":        {"src": true, "alt": true, "title": true},
+	"li":         {},
+	"ol":         {},
+	"p":          {},
+	"pre":        {},
+	"s":          {},
+	"span":       {},
+	"strong":     {},
+	"sub":        {},
+	"sup":        {},
+	"u":          {},
+	"ul":         {},
+}
+
+// void elements have no end tag.
+var void = map[string]bool{
+	"br":  true,
+	"hr":  true,
+	"img": true,
+}
+
+// dropped elements are removed together with everything inside them, because
+// their content is not text meant for the reader.
+var dropped = map[string]bool{
+	"embed":    true,
+	"frame":    true,
+	"frameset": true,
+	"head":     true,
+	"iframe":   true,
+	"math":     true,
+	"noembed":  true,
+	"noframes": true,
+	"noscript": true,
+	"object":   true,
+	"script":   true,
+	"select":   true,
+	"style":    true,
+	"svg":      true,
+	"template": true,
+	"textarea": true,
+	"title":    true,
+	"xmp":      true,
+}
+
+// linkClasses are the classes Link gives to the links it makes. No other class
+// survives, so that content cannot borrow the styling of the page around it.
+var linkClasses = map[string]bool{
+	"mention": true,
+	"hashtag": true,
+}
+
+// safeURL tells whether a link or image URL may be kept. Relative URLs are
+// fine, absolute ones need one of schemes. Browsers ignore whitespace and
+// control characters inside a scheme, so they are ignored here as well.
+func safeURL(raw string, schemes ...string) bool {
+	var b strings.Builder
+	for _, r := range raw {
+		if r > ' ' && r != 0x7f {
+			b.WriteRune(r)
+		}
+	}
+	u := b.String()
+	if strings.HasPrefix(u, "//") || strings.HasPrefix(u, `\\`) || strings.HasPrefix(u, `/\`) {
+		// Protocol relative URLs can point anywhere, allow them only as
+		// http(s).
+		return contains(schemes, "https")
+	}
+	i := strings.IndexAny(u, ":/?#")
+	if i < 0 || u[i] != ':' {
+		return true
+	}
+	return contains(schemes, strings.ToLower(u[:i]))
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// attributes returns the allowed attributes of the current tag of z, escaped and
+// ready to be written after the tag name.
+func attributes(z *html.Tokenizer, tag string, hasAttr bool) string {
+	var b strings.Builder
+	seen := make(map[string]bool)
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		name, value := string(key), string(val)
+		if !allowed[tag][name] || seen[name] {
+			continue
+		}
+		switch {
+		case tag == "a" && name == "href" && !safeURL(value, "http", "https", "mailto"):
+			continue
+		case tag == "img" && name == "src" && !safeURL(value, "http", "https"):
+			continue
+		case name == "class":
+			var classes []string
+			for _, class := range strings.Fields(value) {
+				if linkClasses[class] {
+					classes = append(classes, class)
+				}
+			}
+			if len(classes) == 0 {
+				continue
+			}
+			value = strings.Join(classes, " ")
+		}
+		seen[name] = true
+		b.WriteString(" " + name + `="` + html.EscapeString(value) + `"`)
+	}
+	if tag == "a" {
+		b.WriteString(` rel="nofollow noopener"`)
+	}
+	return b.String()
+}
+
+// Sanitize makes user supplied HTML safe to show to other users. Only the tags
+// and attributes in the allow-list are kept, URLs must be http(s), or mailto
+// for links, and every link gets rel="nofollow noopener". Tags are balanced,
+// so the result cannot break out of the element it is put in.
+//
+// Sanitize is idempotent: sanitizing its output again gives the same result.
+func Sanitize(src string) string {
+	z := html.NewTokenizer(strings.NewReader(src))
+	var b strings.Builder
+	var open []string
+	// dropDepth counts the dropped elements the tokenizer is inside of.
+	dropDepth := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		switch tt {
+		case html.TextToken:
+			if dropDepth == 0 {
+				b.WriteString(html.EscapeString(string(z.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if dropped[tag] {
+				if tt == html.StartTagToken {
+					dropDepth++
+				}
+				continue
+			}
+			if dropDepth > 0 {
+				continue
+			}
+			if _, ok := allowed[tag]; !ok {
+				continue
+			}
+			b.WriteString("<" + tag + attributes(z, tag, hasAttr) + ">")
+			if !void[tag] {
+				if tt == html.SelfClosingTagToken {
+					b.WriteString("</" + tag + ">")
+				} else {
+					open = append(open, tag)
+				}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if dropped[tag] {
+				if dropDepth > 0 {
+					dropDepth--
+				}
+				continue
+			}
+			if dropDepth > 0 {
+				continue
+			}
+			// Close everything opened after tag as well, and ignore end tags
+			// of elements that are not open.
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != tag {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String()
+}
@@ -0,0 +1,174 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// xssCorpus holds well known cross-site scripting payloads. Adding an entry is
+// all it takes to cover another trick.
+var xssCorpus = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=http://xss.example/xss.js></SCRIPT>`,
+	`<scr<script>ipt>alert(1)</scr</script>ipt>`,
+	`<script/src="data:text/javascript,alert(1)"></script>`,
+	`<img src=x onerror=alert(1)>`,
+	`<img src="javascript:alert(1)">`,
+	`<img src=JaVaScRiPt:alert(1)>`,
+	`<img src="jav	ascript:alert(1)">`,
+	`<img src="jav&#x09;ascript:alert(1)">`,
+	`<img src="&#106;&#97;&#118;&#97;&#115;&#99;&#114;&#105;&#112;&#116;&#58;alert(1)">`,
+	`<img src="data:image/svg+xml;base64,PHN2ZyBvbmxvYWQ9YWxlcnQoMSk+">`,
+	`<img """><script>alert(1)</script>">`,
+	`<img src=/ onerror="alert(1)"/>`,
+	`<a href="javascript:alert(1)">click</a>`,
+	`<a href=" javascript:alert(1)">click</a>`,
+	`<a href="&#14;javascript:alert(1)">click</a>`,
+	`<a href="java&#x0A;script:alert(1)">click</a>`,
+	`<a href="vbscript:msgbox(1)">click</a>`,
+	`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">click</a>`,
+	`<a href="//evil.example" target="_blank">click</a>`,
+	`<a href="https://example.com" onclick="alert(1)" style="position:fixed">click</a>`,
+	`<a href="https://example.com" rel="opener">click</a>`,
+	`<p onmouseover="alert(1)">hover</p>`,
+	`<p style="background:url(javascript:alert(1))">styled</p>`,
+	`<body onload=alert(1)>`,
+	`<svg onload=alert(1)>`,
+	`<svg><script>alert(1)</script></svg>`,
+	`<math><mi xlink:href="javascript:alert(1)">x</mi></math>`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<iframe srcdoc="<script>alert(1)</script>"></iframe>`,
+	`<object data="javascript:alert(1)"></object>`,
+	`<embed src="javascript:alert(1)">`,
+	`<form action="javascript:alert(1)"><input type=submit></form>`,
+	`<button formaction="javascript:alert(1)">x</button>`,
+	`<input autofocus onfocus=alert(1)>`,
+	`<details open ontoggle=alert(1)>`,
+	`<video><source onerror="alert(1)"></video>`,
+	`<audio src=x onerror=alert(1)>`,
+	`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+	`<link rel=stylesheet href="javascript:alert(1)">`,
+	`<base href="javascript:alert(1)//">`,
+	`<style>@import 'javascript:alert(1)';</style>`,
+	`<div style="width: expression(alert(1))">x</div>`,
+	`<noscript><p title="</noscript><img src=x onerror=alert(1)>"></noscript>`,
+	`<textarea><script>alert(1)</script></textarea>`,
+	`<title><script>alert(1)</script></title>`,
+	`<template><script>alert(1)</script></template>`,
+	`<xmp><script>alert(1)</script></xmp>`,
+	`<!--<img src="--><img src=x onerror=alert(1)//">`,
+	`<![CDATA[<script>alert(1)</script>]]>`,
+	`<p title="x" title="javascript:alert(1)">dup</p>`,
+	`<a href="https://example.com" title='"><script>alert(1)</script>'>quote</a>`,
+	`"><script>alert(1)</script>`,
+	`</p></div><script>alert(1)</script>`,
+	`<b><i>unclosed`,
+	`<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>`,
+	`<span class="mention hashtag evil">classes</span>`,
+	`<img src="https://example.com/a.png" alt="ok" width="1" height="1">`,
+}
+
+// unsafeMarkup reports the first thing in out that Sanitize must never let
+// through.
+func unsafeMarkup(out string) string {
+	z := html.NewTokenizer(strings.NewReader(out))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return ""
+		case html.CommentToken, html.DoctypeToken:
+			return "comment or doctype"
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			attrs, ok := allowed[tag]
+			if !ok {
+				return "element " + tag
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attr, value := string(key), string(val)
+				switch {
+				case tag == "a" && attr == "rel":
+					if value != "nofollow noopener" {
+						return "rel " + value
+					}
+				case !attrs[attr]:
+					return "attribute " + attr + " on " + tag
+				case attr == "href" && !safeURL(value, "http", "https", "mailto"):
+					return "href " + value
+				case attr == "src" && !safeURL(value, "http", "https"):
+					return "src " + value
+				}
+			}
+		}
+	}
+}
+
+func TestSanitizeCorpus(t *testing.T) {
+	for _, payload := range xssCorpus {
+		t.Run(payload, func(t *testing.T) {
+			out := Sanitize(payload)
+			if problem := unsafeMarkup(out); problem != "" {
+				t.Fatalf("Sanitize(%q) = %q, which keeps %s", payload, out, problem)
+			}
+			if again := Sanitize(out); again != out {
+				t.Fatalf("Sanitize is not idempotent for %q: %q then %q", payload, out, again)
+			}
+		})
+	}
+}
+
+func TestSanitizeRel(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "added",
+			in:   `<a href="https://example.com">click</a>`,
+			want: `<a href="https://example.com" rel="nofollow noopener">click</a>`,
+		},
+		{
+			name: "replaced",
+			in:   `<a href="https://example.com" rel="opener">click</a>`,
+			want: `<a href="https://example.com" rel="nofollow noopener">click</a>`,
+		},
+		{
+			name: "duplicates replaced",
+			in:   `<a href="https://example.com" rel="noreferrer" rel="opener" target="_blank">click</a>`,
+			want: `<a href="https://example.com" rel="nofollow noopener">click</a>`,
+		},
+		{
+			name: "kept on unsafe href",
+			in:   `<a href="javascript:alert(1)" rel="opener">click</a>`,
+			want: `<a rel="nofollow noopener">click</a>`,
+		},
+		{
+			name: "already sanitized",
+			in:   `<a href="/relative" rel="nofollow noopener">click</a>`,
+			want: `<a href="/relative" rel="nofollow noopener">click</a>`,
+		},
+		{
+			name: "other elements",
+			in:   `<p rel="opener">text</p>`,
+			want: `<p>text</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sanitize(tt.in)
+			if got != tt.want {
+				t.Fatalf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if strings.Count(got, "rel=") > 1 {
+				t.Fatalf("Sanitize(%q) = %q, which has more than one rel", tt.in, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package markup
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// inline elements do not break a word in two.
+var inline = map[string]bool{
+	"a":      true,
+	"b":      true,
+	"code":   true,
+	"del":    true,
+	"em":     true,
+	"i":      true,
+	"s":      true,
+	"span":   true,
+	"strong": true,
+	"sub":    true,
+	"sup":    true,
+	"u":      true,
+}
+
+// Text returns the text a reader sees in an HTML document, for search. Tags
+// other than inline ones separate words, entities are decoded and runs of
+// whitespace and control characters become a single space.
+func Text(src string) string {
+	z := html.NewTokenizer(strings.NewReader(src))
+	var b strings.Builder
+	dropDepth := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		switch tt {
+		case html.TextToken:
+			if dropDepth == 0 {
+				b.Write(z.Text())
+			}
+		case html.StartTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if dropped[tag] {
+				if tt == html.StartTagToken {
+					dropDepth++
+				} else {
+					dropDepth = max(dropDepth-1, 0)
+				}
+			}
+			if !inline[tag] {
+				b.WriteByte(' ')
+			}
+		case html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			if !inline[string(name)] {
+				b.WriteByte(' ')
+			}
+		}
+	}
+	words := strings.FieldsFunc(b.String(), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+	return strings.Join(words, " ")
+}
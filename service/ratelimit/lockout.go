@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Lockout locks accounts out progressively after repeated failed logins: the
+// first lock lasts BaseLock once Threshold failures piled up, and every further
+// failure doubles it up to MaxLock.
+type Lockout struct {
+	store     Store
+	Threshold int
+	BaseLock  time.Duration
+	MaxLock   time.Duration
+	// Memory is how long failures are remembered without a new one.
+	Memory time.Duration
+}
+
+func NewLockout(store Store) *Lockout {
+	return &Lockout{
+		store:     store,
+		Threshold: 5,
+		BaseLock:  time.Minute,
+		MaxLock:   time.Hour,
+		Memory:    24 * time.Hour,
+	}
+}
+
+func lockoutKey(account string) string {
+	return "lockout:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+// Locked returns how long account stays locked, or zero when it is not.
+func (l *Lockout) Locked(ctx context.Context, account string) (time.Duration, error) {
+	until, err := l.store.Locked(ctx, lockoutKey(account))
+	if err != nil || until.IsZero() {
+		return 0, err
+	}
+	return time.Until(until), nil
+}
+
+// Fail records a failed login on account and returns the lock it earned, if
+// any.
+func (l *Lockout) Fail(ctx context.Context, account string) (time.Duration, error) {
+	key := lockoutKey(account)
+	count, err := l.store.AddFailure(ctx, key, l.Memory)
+	if err != nil {
+		return 0, err
+	}
+	if count < l.Threshold {
+		return 0, nil
+	}
+
+	lock := l.BaseLock
+	for i := l.Threshold; i < count && lock < l.MaxLock; i++ {
+		lock *= 2
+	}
+	if lock > l.MaxLock {
+		lock = l.MaxLock
+	}
+	if err := l.store.Lock(ctx, key, time.Now().Add(lock)); err != nil {
+		return 0, err
+	}
+	return lock, nil
+}
+
+// Succeed clears the failures of account after a successful login.
+func (l *Lockout) Succeed(ctx context.Context, account string) error {
+	return l.store.Reset(ctx, lockoutKey(account))
+}
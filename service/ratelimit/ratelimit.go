@@ -0,0 +1,173 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Rate allows Limit requests per Period. Tokens refill continuously, so a
+// client that waited Period/Limit may send one more request.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+func PerMinute(limit int) Rate {
+	return Rate{Limit: limit, Period: time.Minute}
+}
+
+func PerHour(limit int) Rate {
+	return Rate{Limit: limit, Period: time.Hour}
+}
+
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long it takes until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long a rejected client has to wait for one token.
+	RetryAfter time.Duration
+}
+
+// Store keeps the token buckets and the login failures. MemoryStore keeps them
+// in process; a shared backend lets several instances enforce the same limits.
+type Store interface {
+	Take(ctx context.Context, key string, rate Rate) (Result, error)
+	// AddFailure records a failed attempt on key and returns the number of
+	// failures since the last Reset. Failures are forgotten after ttl without
+	// a new one.
+	AddFailure(ctx context.Context, key string, ttl time.Duration) (int, error)
+	// Lock blocks key until the given time; Locked reports it.
+	Lock(ctx context.Context, key string, until time.Time) error
+	Locked(ctx context.Context, key string) (time.Time, error)
+	Reset(ctx context.Context, key string) error
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+type failures struct {
+	count       int
+	last        time.Time
+	ttl         time.Duration
+	lockedUntil time.Time
+}
+
+// sweepInterval is how often MemoryStore drops state that no longer matters.
+const sweepInterval = time.Minute
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	failures  map[string]*failures
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]*bucket),
+		failures: make(map[string]*failures),
+	}
+}
+
+// sweep forgets full buckets, which behave exactly like missing ones, and
+// failures that expired.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= b.period {
+			delete(s.buckets, key)
+		}
+	}
+	for key, f := range s.failures {
+		if now.Sub(f.last) >= f.ttl && now.After(f.lockedUntil) {
+			delete(s.failures, key)
+		}
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, rate Rate) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	limit := float64(rate.Limit)
+	perToken := rate.Period / time.Duration(rate.Limit)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit, last: now, period: rate.Period}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(limit, b.tokens+float64(now.Sub(b.last))/float64(perToken))
+	b.last = now
+
+	var res Result
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((limit - b.tokens) * float64(perToken))
+	return res, nil
+}
+
+func (s *MemoryStore) AddFailure(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	f, ok := s.failures[key]
+	if !ok || now.Sub(f.last) >= f.ttl {
+		f = &failures{}
+		s.failures[key] = f
+	}
+	f.count++
+	f.last = now
+	f.ttl = ttl
+	return f.count, nil
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.failures[key]
+	if !ok {
+		f = &failures{last: time.Now()}
+		s.failures[key] = f
+	}
+	f.lockedUntil = until
+	return nil
+}
+
+func (s *MemoryStore) Locked(ctx context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.failures[key]; ok && time.Now().Before(f.lockedUntil) {
+		return f.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
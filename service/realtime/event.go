@@ -0,0 +1,61 @@
+package realtime
+
+import (
+	"strconv"
+
+	"github.com/billymosis/socialmedia-app/model"
+)
+
+type PostCreated struct {
+	PostId     string `json:"postId"`
+	CreatorId  string `json:"creatorId"`
+	Visibility string `json:"visibility"`
+}
+
+type CommentCreated struct {
+	CommentId       string  `json:"commentId"`
+	PostId          string  `json:"postId"`
+	ParentCommentId *string `json:"parentCommentId"`
+	CreatorId       string  `json:"creatorId"`
+}
+
+type FriendChanged struct {
+	UserId string `json:"userId"`
+}
+
+type NotificationCreated struct {
+	Type     string `json:"type"`
+	ActorId  string `json:"actorId"`
+	TargetId string `json:"targetId"`
+}
+
+type MessageRead struct {
+	ConversationId    string `json:"conversationId"`
+	UserId            string `json:"userId"`
+	LastReadMessageId string `json:"lastReadMessageId"`
+}
+
+type ConversationUpdated struct {
+	ConversationId string `json:"conversationId"`
+}
+
+// Notify forwards notifications that were committed to their recipients,
+// skipping the ones a user triggered on their own content like Push does.
+func (h *Hub) Notify(events ...model.NotificationEvent) {
+	for _, event := range events {
+		if event.UserId == event.ActorId {
+			continue
+		}
+		h.Publish(event.UserId, EventNotification, NotificationCreated{
+			Type:     event.Type,
+			ActorId:  strconv.Itoa(event.ActorId),
+			TargetId: strconv.Itoa(event.TargetId),
+		})
+	}
+}
+
+// PublishFriendChange tells both users that their friendship changed.
+func (h *Hub) PublishFriendChange(eventType string, firstId int, secondId int) {
+	h.Publish(firstId, eventType, FriendChanged{UserId: strconv.Itoa(secondId)})
+	h.Publish(secondId, eventType, FriendChanged{UserId: strconv.Itoa(firstId)})
+}
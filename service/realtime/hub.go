@@ -0,0 +1,197 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// backlogSize is the number of recent events kept per user so that a
+	// reconnecting client can resume from its last event id.
+	backlogSize = 100
+	backlogTTL  = 5 * time.Minute
+	bufferSize  = 32
+)
+
+// SweepInterval is how often Sweep should run. Nothing stays in a backlog for
+// much longer than backlogTTL then.
+const SweepInterval = backlogTTL
+
+const (
+	EventPostCreated    = "post.created"
+	EventCommentCreated = "comment.created"
+	EventFriendAdded    = "friend.added"
+	EventFriendRemoved  = "friend.removed"
+	EventNotification   = "notification"
+	EventMessageCreated = "message.created"
+	EventMessageRead    = "message.read"
+	// EventConversationUpdated is sent when the title, avatar, members or
+	// roles of a group change.
+	EventConversationUpdated = "conversation.updated"
+	// EventResync tells a client that events were dropped since its last event
+	// id and that it has to refetch its state.
+	EventResync = "resync"
+)
+
+type Event struct {
+	Id        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+type userState struct {
+	backlog []Event
+	// evicted is the id of the newest event that no longer is in backlog.
+	evicted uint64
+	subs    map[*Subscription]struct{}
+}
+
+// Hub fans events out to the connected clients of a user. A nil *Hub is valid
+// and drops every event, so stores can be used without realtime delivery.
+type Hub struct {
+	mu     sync.Mutex
+	nextId uint64
+	users  map[int]*userState
+	// forgotten is the id of the newest event that was evicted from the state
+	// of a user who was forgotten since. Reconnecting users without state may
+	// have missed any event up to it.
+	forgotten uint64
+}
+
+type Subscription struct {
+	C      chan Event
+	hub    *Hub
+	userId int
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		users: make(map[int]*userState),
+	}
+}
+
+func (h *Hub) state(userId int) *userState {
+	st, ok := h.users[userId]
+	if !ok {
+		st = &userState{subs: make(map[*Subscription]struct{})}
+		h.users[userId] = st
+	}
+	return st
+}
+
+// prune drops backlog entries that are too old and forgets users that have
+// neither recent events nor subscribers.
+func (h *Hub) prune(userId int, st *userState, now time.Time) {
+	i := 0
+	for i < len(st.backlog) && now.Sub(st.backlog[i].CreatedAt) > backlogTTL {
+		st.evicted = st.backlog[i].Id
+		i++
+	}
+	st.backlog = st.backlog[i:]
+	if len(st.backlog) == 0 && len(st.subs) == 0 {
+		h.forgotten = max(h.forgotten, st.evicted)
+		delete(h.users, userId)
+	}
+}
+
+// Sweep prunes the state of every user. Without it, users who receive events
+// while they are offline would keep them until they publish or subscribe.
+func (h *Hub) Sweep() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for userId, st := range h.users {
+		h.prune(userId, st, now)
+	}
+}
+
+func (h *Hub) Publish(userId int, eventType string, data interface{}) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextId++
+	now := time.Now()
+	event := Event{
+		Id:        h.nextId,
+		Type:      eventType,
+		Data:      data,
+		CreatedAt: now,
+	}
+
+	st := h.state(userId)
+	st.backlog = append(st.backlog, event)
+	if len(st.backlog) > backlogSize {
+		st.evicted = st.backlog[0].Id
+		st.backlog = st.backlog[1:]
+	}
+
+	for sub := range st.subs {
+		select {
+		case sub.C <- event:
+		default:
+			// The client is not keeping up. Closing the subscription makes it
+			// reconnect and resume from the backlog instead of silently
+			// missing events.
+			delete(st.subs, sub)
+			close(sub.C)
+		}
+	}
+	h.prune(userId, st, now)
+}
+
+// Subscribe registers a client of userId. The returned events are the ones
+// published after lastEventId that are still in the backlog; they must be sent
+// before reading from the subscription channel.
+func (h *Hub) Subscribe(userId int, lastEventId uint64) (*Subscription, []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st := h.state(userId)
+	h.prune(userId, st, time.Now())
+	st = h.state(userId)
+
+	// Events up to the watermark are gone. The state of the user may have been
+	// forgotten and recreated, so the hub wide one counts as well.
+	watermark := max(st.evicted, h.forgotten)
+
+	var missed []Event
+	if lastEventId > 0 {
+		if lastEventId < watermark {
+			missed = append(missed, Event{Id: watermark, Type: EventResync, CreatedAt: time.Now()})
+		}
+		for _, event := range st.backlog {
+			if event.Id > lastEventId {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		C:      make(chan Event, bufferSize),
+		hub:    h,
+		userId: userId,
+	}
+	st.subs[sub] = struct{}{}
+	return sub, missed
+}
+
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st, ok := h.users[s.userId]
+	if !ok {
+		return
+	}
+	if _, ok := st.subs[s]; ok {
+		delete(st.subs, s)
+		close(s.C)
+	}
+	h.prune(s.userId, st, time.Now())
+}
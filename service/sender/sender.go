@@ -0,0 +1,57 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sender delivers a short text message to an email address or phone number.
+// channel is the credential type the address belongs to.
+type Sender interface {
+	Send(ctx context.Context, channel string, to string, message string) error
+}
+
+// LogSender writes messages to the application log instead of delivering them.
+// It is meant for local development only.
+type LogSender struct{}
+
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+func (s *LogSender) Send(ctx context.Context, channel string, to string, message string) error {
+	logrus.WithFields(logrus.Fields{
+		"channel": channel,
+		"to":      to,
+	}).Info(message)
+	return nil
+}
+
+// FileSender appends messages to a file so that local tooling can pick up the
+// codes that would have been sent.
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (s *FileSender) Send(ctx context.Context, channel string, to string, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), channel, to, message)
+	return err
+}
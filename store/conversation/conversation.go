@@ -0,0 +1,724 @@
+package conversation
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/helper"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/realtime"
+	"github.com/billymosis/socialmedia-app/store/relation"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrConversationNotFound = errors.New("conversation not found")
+	ErrMessageNotFound      = errors.New("message not found")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrNotFriend            = errors.New("messages can only be sent to friends")
+	ErrSelfConversation     = errors.New("cannot start a conversation with yourself")
+	ErrInvalidAfter         = errors.New("bad request: invalid after")
+	ErrInvalidWait          = errors.New("bad request: invalid wait")
+)
+
+type ConversationStore struct {
+	db       *pgxpool.Pool
+	Validate *validator.Validate
+	events   *realtime.Hub
+}
+
+func NewConversationStore(db *pgxpool.Pool, validate *validator.Validate, events *realtime.Hub) *ConversationStore {
+	return &ConversationStore{
+		db:       db,
+		Validate: validate,
+		events:   events,
+	}
+}
+
+const messageColumns = "SELECT id, conversation_id, sender_id, kind, target_user_id, body, created_at FROM messages"
+
+const conversationColumns = `
+		SELECT c.id, c.is_group, c.title, c.avatar_url, c.last_message_id, c.created_at, c.updated_at
+		FROM conversations c
+		JOIN conversation_members cm ON cm.conversation_id = c.id`
+
+func scanMessage(row pgx.Row) (model.Message, error) {
+	var m model.Message
+	err := row.Scan(&m.Id, &m.ConversationId, &m.SenderId, &m.Kind, &m.TargetUserId, &m.Body, &m.CreatedAt)
+	return m, err
+}
+
+func scanConversation(row pgx.Row) (model.Conversation, error) {
+	var c model.Conversation
+	err := row.Scan(&c.Id, &c.IsGroup, &c.Title, &c.AvatarUrl, &c.LastMessageId, &c.CreatedAt, &c.UpdatedAt)
+	return c, err
+}
+
+func toMessageResponse(m model.Message) model.MessageResponseData {
+	res := model.MessageResponseData{
+		MessageId:      strconv.Itoa(m.Id),
+		ConversationId: strconv.Itoa(m.ConversationId),
+		SenderId:       strconv.Itoa(m.SenderId),
+		Type:           m.Kind,
+		Message:        m.Body,
+		CreatedAt:      m.CreatedAt,
+	}
+	if m.TargetUserId != nil {
+		targetId := strconv.Itoa(*m.TargetUserId)
+		res.TargetUserId = &targetId
+	}
+	return res
+}
+
+func isFriend(ctx context.Context, tx pgx.Tx, firstId int, secondId int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+		    SELECT 1
+		    FROM relationships
+		    WHERE (user_first_id = $1 AND user_second_id = $2)
+		    OR (user_first_id = $2 AND user_second_id = $1)
+		)
+	`
+	var exist bool
+	if err := tx.QueryRow(ctx, query, firstId, secondId).Scan(&exist); err != nil {
+		return false, errors.Wrap(err, "failed check relation exist")
+	}
+	return exist, nil
+}
+
+// OpenDirect returns the one-to-one conversation between userId and otherId,
+// creating it the first time two friends talk to each other.
+func (cs *ConversationStore) OpenDirect(ctx context.Context, otherId int, userId int) (*model.ConversationResponseData, error) {
+	if otherId == userId {
+		return nil, ErrSelfConversation
+	}
+
+	tx, err := cs.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	var exist bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", otherId).Scan(&exist)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed check user exist")
+	}
+	if !exist {
+		return nil, ErrUserNotFound
+	}
+	friend, err := isFriend(ctx, tx, otherId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !friend {
+		return nil, ErrNotFriend
+	}
+
+	first, second := userId, otherId
+	if first > second {
+		first, second = second, first
+	}
+
+	var conversationId int
+	query := `
+		INSERT INTO conversations (direct_first_id, direct_second_id)
+		VALUES ($1, $2)
+		ON CONFLICT (direct_first_id, direct_second_id) WHERE direct_first_id IS NOT NULL
+		DO UPDATE SET direct_first_id = EXCLUDED.direct_first_id
+		RETURNING id
+	`
+	if err := tx.QueryRow(ctx, query, first, second).Scan(&conversationId); err != nil {
+		return nil, errors.Wrap(err, "failed to create conversation")
+	}
+
+	query = `
+		INSERT INTO conversation_members (conversation_id, user_id)
+		VALUES ($1, $2), ($1, $3)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := tx.Exec(ctx, query, conversationId, first, second); err != nil {
+		return nil, errors.Wrap(err, "failed to add conversation members")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to commit conversation")
+	}
+	return cs.GetConversation(ctx, conversationId, userId)
+}
+
+// membership is what a participant may do in a conversation they are locking.
+type membership struct {
+	group bool
+	role  string
+	// otherId is the other participant of a one-to-one conversation.
+	otherId int
+}
+
+// lockConversation checks that userId takes part in the conversation and
+// serializes writers on it.
+func lockConversation(ctx context.Context, tx pgx.Tx, conversationId int, userId int) (*membership, error) {
+	var m membership
+	var firstId, secondId *int
+	query := `
+		SELECT c.is_group, cm.role, c.direct_first_id, c.direct_second_id
+		FROM conversations c
+		JOIN conversation_members cm ON cm.conversation_id = c.id AND cm.user_id = $2
+		WHERE c.id = $1
+		FOR UPDATE OF c
+	`
+	err := tx.QueryRow(ctx, query, conversationId, userId).Scan(&m.group, &m.role, &firstId, &secondId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, errors.Wrap(err, "failed to get conversation")
+	}
+	if firstId != nil && secondId != nil {
+		m.otherId = *firstId
+		if m.otherId == userId {
+			m.otherId = *secondId
+		}
+	}
+	return &m, nil
+}
+
+func memberIds(ctx context.Context, tx pgx.Tx, conversationId int) ([]int, error) {
+	rows, err := tx.Query(ctx, "SELECT user_id FROM conversation_members WHERE conversation_id = $1", conversationId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get conversation members")
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan conversation members")
+	}
+	return ids, nil
+}
+
+// SendMessage appends a message to the conversation and delivers it to every
+// participant's realtime stream once it is committed.
+func (cs *ConversationStore) SendMessage(ctx context.Context, conversationId int, body string, userId int) (*model.MessageResponseData, error) {
+	tx, err := cs.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	member, err := lockConversation(ctx, tx, conversationId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !member.group {
+		friend, err := isFriend(ctx, tx, member.otherId, userId)
+		if err != nil {
+			return nil, err
+		}
+		if !friend {
+			return nil, ErrNotFriend
+		}
+	}
+
+	message, err := insertMessage(ctx, tx, model.Message{
+		ConversationId: conversationId,
+		SenderId:       userId,
+		Kind:           model.MessageText,
+		Body:           body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := memberIds(ctx, tx, conversationId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to commit message")
+	}
+
+	res := toMessageResponse(*message)
+	cs.publish(members, realtime.EventMessageCreated, res)
+	return &res, nil
+}
+
+// insertMessage stores message and moves the conversation and the read receipt
+// of the sender, who has obviously seen it, to it.
+func insertMessage(ctx context.Context, tx pgx.Tx, message model.Message) (*model.Message, error) {
+	query := `
+		INSERT INTO messages (conversation_id, sender_id, kind, target_user_id, body)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	err := tx.QueryRow(ctx, query, message.ConversationId, message.SenderId, message.Kind, message.TargetUserId, message.Body).Scan(&message.Id, &message.CreatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create message")
+	}
+
+	query = `
+		UPDATE conversations SET last_message_id = $1, updated_at = $2
+		WHERE id = $3
+	`
+	if _, err := tx.Exec(ctx, query, message.Id, message.CreatedAt, message.ConversationId); err != nil {
+		return nil, errors.Wrap(err, "failed to update conversation")
+	}
+
+	query = `
+		UPDATE conversation_members SET last_read_message_id = $1, last_read_at = $2
+		WHERE conversation_id = $3 AND user_id = $4
+	`
+	if _, err := tx.Exec(ctx, query, message.Id, message.CreatedAt, message.ConversationId, message.SenderId); err != nil {
+		return nil, errors.Wrap(err, "failed to update read receipt")
+	}
+	return &message, nil
+}
+
+func (cs *ConversationStore) publish(userIds []int, eventType string, data interface{}) {
+	for _, userId := range userIds {
+		cs.events.Publish(userId, eventType, data)
+	}
+}
+
+// MarkRead moves the read receipt of userId up to messageId, or to the newest
+// message when messageId is 0. Receipts never move backwards.
+func (cs *ConversationStore) MarkRead(ctx context.Context, conversationId int, messageId int, userId int) error {
+	tx, err := cs.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockConversation(ctx, tx, conversationId, userId); err != nil {
+		return err
+	}
+
+	if messageId == 0 {
+		query := "SELECT COALESCE(last_message_id, 0) FROM conversations WHERE id = $1"
+		if err := tx.QueryRow(ctx, query, conversationId).Scan(&messageId); err != nil {
+			return errors.Wrap(err, "failed to get last message")
+		}
+	} else {
+		var exist bool
+		query := "SELECT EXISTS (SELECT 1 FROM messages WHERE id = $1 AND conversation_id = $2)"
+		if err := tx.QueryRow(ctx, query, messageId, conversationId).Scan(&exist); err != nil {
+			return errors.Wrap(err, "failed check message exist")
+		}
+		if !exist {
+			return ErrMessageNotFound
+		}
+	}
+
+	query := `
+		UPDATE conversation_members SET last_read_message_id = $1, last_read_at = CURRENT_TIMESTAMP
+		WHERE conversation_id = $2 AND user_id = $3 AND last_read_message_id < $1
+	`
+	tag, err := tx.Exec(ctx, query, messageId, conversationId, userId)
+	if err != nil {
+		return errors.Wrap(err, "failed to update read receipt")
+	}
+
+	members, err := memberIds(ctx, tx, conversationId)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit read receipt")
+	}
+
+	if tag.RowsAffected() > 0 {
+		receipt := realtime.MessageRead{
+			ConversationId:    strconv.Itoa(conversationId),
+			UserId:            strconv.Itoa(userId),
+			LastReadMessageId: strconv.Itoa(messageId),
+		}
+		cs.publish(members, realtime.EventMessageRead, receipt)
+	}
+	return nil
+}
+
+// MaxMessageWait bounds how long GetMessages holds a long poll open.
+const MaxMessageWait = 30 * time.Second
+
+// GetMessages pages through the history of a conversation, newest first. With
+// after set to a message id it returns the messages that followed it instead,
+// oldest first, and with wait it long polls: when there are none yet it blocks
+// until one is sent or the wait is over.
+func (cs *ConversationStore) GetMessages(ctx context.Context, conversationId int, userId int, queryParams url.Values) (*model.MessageListResponse, error) {
+	limit, err := helper.CursorLimit(queryParams.Get("limit"), 30, 100)
+	if err != nil {
+		return nil, err
+	}
+
+	var member bool
+	query := "SELECT EXISTS (SELECT 1 FROM conversation_members WHERE conversation_id = $1 AND user_id = $2)"
+	if err := cs.db.QueryRow(ctx, query, conversationId, userId).Scan(&member); err != nil {
+		return nil, errors.Wrap(err, "failed check conversation member")
+	}
+	if !member {
+		return nil, ErrConversationNotFound
+	}
+
+	if queryParams.Get("after") == "" {
+		if queryParams.Get("wait") != "" {
+			return nil, ErrInvalidWait
+		}
+		return cs.messagesBefore(ctx, conversationId, queryParams.Get("cursor"), limit)
+	}
+	afterId, err := strconv.Atoi(queryParams.Get("after"))
+	if err != nil || afterId < 0 {
+		return nil, ErrInvalidAfter
+	}
+	var wait time.Duration
+	if value := queryParams.Get("wait"); value != "" {
+		wait, err = time.ParseDuration(value)
+		if err != nil || wait < 0 || wait > MaxMessageWait {
+			return nil, ErrInvalidWait
+		}
+	}
+	if wait == 0 || cs.events == nil {
+		return cs.messagesAfter(ctx, conversationId, afterId, limit)
+	}
+
+	// Subscribing before looking for messages makes sure that one sent in
+	// between is not missed.
+	sub, _ := cs.events.Subscribe(userId, 0)
+	defer sub.Close()
+
+	res, err := cs.messagesAfter(ctx, conversationId, afterId, limit)
+	if err != nil || len(res.Data) > 0 {
+		return res, err
+	}
+	if !waitMessage(ctx, sub, conversationId, wait) {
+		return res, nil
+	}
+	return cs.messagesAfter(ctx, conversationId, afterId, limit)
+}
+
+// waitMessage blocks until a message of conversationId is published to sub, the
+// wait is over or ctx is done. It reports whether there may be new messages.
+func waitMessage(ctx context.Context, sub *realtime.Subscription, conversationId int, wait time.Duration) bool {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	id := strconv.Itoa(conversationId)
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				// The hub dropped the subscription for falling behind, which
+				// only happens when events were published.
+				return true
+			}
+			if event.Type != realtime.EventMessageCreated {
+				continue
+			}
+			if message, ok := event.Data.(model.MessageResponseData); ok && message.ConversationId == id {
+				return true
+			}
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (cs *ConversationStore) messagesBefore(ctx context.Context, conversationId int, cursor string, limit int) (*model.MessageListResponse, error) {
+	q := helper.Query{}
+	q.Query(messageColumns + " WHERE conversation_id = ")
+	q.Param(conversationId)
+	if cursor != "" {
+		createdAt, cursorId, err := helper.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		q.Query(" AND (created_at, id) < (")
+		q.Param(createdAt)
+		q.Query(", ")
+		q.Param(cursorId)
+		q.Query(")")
+	}
+	q.Query(" ORDER BY created_at DESC, id DESC LIMIT ")
+	q.Param(limit + 1)
+	query, params := q.Get()
+
+	messages, err := cs.queryMessages(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := model.MessageListResponse{
+		Data: []model.MessageResponseData{},
+	}
+	res.Meta.Limit = limit
+	if len(messages) > limit {
+		messages = messages[:limit]
+		last := messages[len(messages)-1]
+		res.Meta.NextCursor = helper.EncodeCursor(last.CreatedAt, last.Id)
+	}
+	for _, m := range messages {
+		res.Data = append(res.Data, toMessageResponse(m))
+	}
+	return &res, nil
+}
+
+// messagesAfter returns up to limit messages that followed afterId, oldest
+// first. Clients poll on with the id of the last one.
+func (cs *ConversationStore) messagesAfter(ctx context.Context, conversationId int, afterId int, limit int) (*model.MessageListResponse, error) {
+	query := messageColumns + " WHERE conversation_id = $1 AND id > $2 ORDER BY id LIMIT $3"
+	messages, err := cs.queryMessages(ctx, query, conversationId, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := model.MessageListResponse{
+		Data: []model.MessageResponseData{},
+	}
+	res.Meta.Limit = limit
+	for _, m := range messages {
+		res.Data = append(res.Data, toMessageResponse(m))
+	}
+	return &res, nil
+}
+
+func (cs *ConversationStore) queryMessages(ctx context.Context, query string, params ...interface{}) ([]model.Message, error) {
+	rows, err := cs.db.Query(ctx, query, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get messages")
+	}
+	defer rows.Close()
+
+	messages := make([]model.Message, 0)
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan message")
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	return messages, nil
+}
+
+func (cs *ConversationStore) GetConversation(ctx context.Context, conversationId int, userId int) (*model.ConversationResponseData, error) {
+	query := conversationColumns + " WHERE c.id = $1 AND cm.user_id = $2"
+	c, err := scanConversation(cs.db.QueryRow(ctx, query, conversationId, userId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, errors.Wrap(err, "failed to get conversation")
+	}
+
+	conversations, err := cs.describe(ctx, []model.Conversation{c}, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &conversations[0], nil
+}
+
+// GetConversationList returns the conversations of userId, the most recently
+// active first.
+func (cs *ConversationStore) GetConversationList(ctx context.Context, userId int, queryParams url.Values) (*model.ConversationListResponse, error) {
+	limit, err := helper.CursorLimit(queryParams.Get("limit"), 20, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	q := helper.Query{}
+	q.Query(conversationColumns + " WHERE cm.user_id = ")
+	q.Param(userId)
+	if cursor := queryParams.Get("cursor"); cursor != "" {
+		updatedAt, cursorId, err := helper.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		q.Query(" AND (c.updated_at, c.id) < (")
+		q.Param(updatedAt)
+		q.Query(", ")
+		q.Param(cursorId)
+		q.Query(")")
+	}
+	q.Query(" ORDER BY c.updated_at DESC, c.id DESC LIMIT ")
+	q.Param(limit + 1)
+	query, params := q.Get()
+
+	rows, err := cs.db.Query(ctx, query, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get conversations")
+	}
+	defer rows.Close()
+
+	conversations := make([]model.Conversation, 0)
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan conversation")
+		}
+		conversations = append(conversations, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+
+	res := model.ConversationListResponse{}
+	res.Meta.Limit = limit
+	if len(conversations) > limit {
+		conversations = conversations[:limit]
+		last := conversations[len(conversations)-1]
+		res.Meta.NextCursor = helper.EncodeCursor(last.UpdatedAt, last.Id)
+	}
+	res.Data, err = cs.describe(ctx, conversations, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// describe loads members with their read receipts, the last message and the
+// unread count of userId for every conversation, one query per kind of data.
+func (cs *ConversationStore) describe(ctx context.Context, conversations []model.Conversation, userId int) ([]model.ConversationResponseData, error) {
+	data := make([]model.ConversationResponseData, 0, len(conversations))
+	if len(conversations) == 0 {
+		return data, nil
+	}
+
+	ids := make([]int, 0, len(conversations))
+	messageIds := make([]int, 0, len(conversations))
+	for _, c := range conversations {
+		ids = append(ids, c.Id)
+		if c.LastMessageId != nil {
+			messageIds = append(messageIds, *c.LastMessageId)
+		}
+	}
+
+	members := make(map[int][]model.ConversationMember)
+	muted := make(map[int]*time.Time)
+	query := `
+		SELECT cm.conversation_id, cm.role, cm.last_read_message_id, cm.last_read_at, cm.muted_until,
+		       u.id, u.name, u.image_url, u.friend_count, u.created_at
+		FROM conversation_members cm
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.conversation_id = ANY($1)
+		ORDER BY cm.conversation_id, cm.joined_at, u.id
+	`
+	rows, err := cs.db.Query(ctx, query, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get conversation members")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var conversationId, lastRead int
+		var lastReadAt, mutedUntil *time.Time
+		var imageUrl sql.NullString
+		var member model.ConversationMember
+		err := rows.Scan(
+			&conversationId,
+			&member.Role,
+			&lastRead,
+			&lastReadAt,
+			&mutedUntil,
+			&member.UserId,
+			&member.Name,
+			&imageUrl,
+			&member.FriendCount,
+			&member.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan conversation member")
+		}
+		member.ImageURL = imageUrl.String
+		member.LastReadMessageId = strconv.Itoa(lastRead)
+		member.LastReadAt = lastReadAt
+		if member.UserId == userId {
+			muted[conversationId] = mutedUntil
+		}
+		members[conversationId] = append(members[conversationId], member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	var creators []*model.CreatorValid
+	for id := range members {
+		for i := range members[id] {
+			creators = append(creators, &members[id][i].CreatorValid)
+		}
+	}
+	if err := relation.Annotate(ctx, cs.db, userId, creators); err != nil {
+		return nil, err
+	}
+
+	lastMessages := make(map[int]model.MessageResponseData)
+	rows, err = cs.db.Query(ctx, messageColumns+" WHERE id = ANY($1)", messageIds)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get last messages")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan message")
+		}
+		lastMessages[m.ConversationId] = toMessageResponse(m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+
+	unread := make(map[int]int)
+	query = `
+		SELECT cm.conversation_id, COUNT(m.id)
+		FROM conversation_members cm
+		JOIN messages m ON m.conversation_id = cm.conversation_id
+		    AND m.id > cm.last_read_message_id
+		    AND m.sender_id <> cm.user_id
+		WHERE cm.user_id = $1 AND cm.conversation_id = ANY($2)
+		GROUP BY cm.conversation_id
+	`
+	rows, err = cs.db.Query(ctx, query, userId, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count unread messages")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var conversationId, count int
+		if err := rows.Scan(&conversationId, &count); err != nil {
+			return nil, errors.Wrap(err, "failed to scan unread count")
+		}
+		unread[conversationId] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+
+	for _, c := range conversations {
+		res := model.ConversationResponseData{
+			ConversationId: strconv.Itoa(c.Id),
+			IsGroup:        c.IsGroup,
+			Title:          c.Title,
+			AvatarUrl:      c.AvatarUrl,
+			Members:        members[c.Id],
+			UnreadCount:    unread[c.Id],
+			MutedUntil:     muted[c.Id],
+			CreatedAt:      c.CreatedAt,
+			UpdatedAt:      c.UpdatedAt,
+		}
+		if res.Members == nil {
+			res.Members = []model.ConversationMember{}
+		}
+		if m, ok := lastMessages[c.Id]; ok {
+			res.LastMessage = &m
+		}
+		data = append(data, res)
+	}
+	return data, nil
+}
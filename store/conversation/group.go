@@ -0,0 +1,504 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/realtime"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNotGroup          = errors.New("conversation is not a group")
+	ErrForbidden         = errors.New("forbidden")
+	ErrAlreadyMember     = errors.New("user already is a member")
+	ErrMemberNotFound    = errors.New("member not found")
+	ErrOwnerMustTransfer = errors.New("owner must transfer ownership before leaving")
+	ErrBlockedMember     = errors.New("user blocked a member of the conversation or was blocked by one")
+)
+
+// roleRank orders roles so that members can only manage roles below their own.
+var roleRank = map[string]int{
+	model.ConversationRoleMember: 0,
+	model.ConversationRoleAdmin:  1,
+	model.ConversationRoleOwner:  2,
+}
+
+// groupChange collects what a membership change has to tell the participants
+// once its transaction is committed.
+type groupChange struct {
+	conversationId int
+	recipients     []int
+	messages       []model.MessageResponseData
+}
+
+func (cs *ConversationStore) publishChange(change *groupChange) {
+	for _, message := range change.messages {
+		cs.publish(change.recipients, realtime.EventMessageCreated, message)
+	}
+	cs.publish(change.recipients, realtime.EventConversationUpdated, realtime.ConversationUpdated{
+		ConversationId: strconv.Itoa(change.conversationId),
+	})
+}
+
+func userName(ctx context.Context, tx pgx.Tx, userId int) (string, error) {
+	var name string
+	if err := tx.QueryRow(ctx, "SELECT name FROM users WHERE id = $1", userId).Scan(&name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+		return "", errors.Wrap(err, "failed to get user")
+	}
+	return name, nil
+}
+
+// systemMessage records a membership change of targetId made by actorId.
+func (change *groupChange) systemMessage(ctx context.Context, tx pgx.Tx, kind string, actorId int, targetId int) error {
+	actor, err := userName(ctx, tx, actorId)
+	if err != nil {
+		return err
+	}
+	target, err := userName(ctx, tx, targetId)
+	if err != nil {
+		return err
+	}
+
+	var body string
+	switch kind {
+	case model.MessageGroupCreated:
+		body = fmt.Sprintf("%s created the group", actor)
+	case model.MessageMemberAdded:
+		body = fmt.Sprintf("%s added %s", actor, target)
+	case model.MessageMemberRemoved:
+		body = fmt.Sprintf("%s removed %s", actor, target)
+	case model.MessageMemberLeft:
+		body = fmt.Sprintf("%s left the group", actor)
+	case model.MessageOwnerChanged:
+		body = fmt.Sprintf("%s made %s the owner", actor, target)
+	}
+
+	message, err := insertMessage(ctx, tx, model.Message{
+		ConversationId: change.conversationId,
+		SenderId:       actorId,
+		Kind:           kind,
+		TargetUserId:   &targetId,
+		Body:           body,
+	})
+	if err != nil {
+		return err
+	}
+	change.messages = append(change.messages, toMessageResponse(*message))
+	return nil
+}
+
+// lockGroup locks a group conversation userId belongs to.
+func lockGroup(ctx context.Context, tx pgx.Tx, conversationId int, userId int) (*membership, error) {
+	member, err := lockConversation(ctx, tx, conversationId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !member.group {
+		return nil, ErrNotGroup
+	}
+	return member, nil
+}
+
+func memberRole(ctx context.Context, tx pgx.Tx, conversationId int, userId int) (string, error) {
+	var role string
+	query := "SELECT role FROM conversation_members WHERE conversation_id = $1 AND user_id = $2"
+	if err := tx.QueryRow(ctx, query, conversationId, userId).Scan(&role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrMemberNotFound
+		}
+		return "", errors.Wrap(err, "failed to get member")
+	}
+	return role, nil
+}
+
+func setRole(ctx context.Context, tx pgx.Tx, conversationId int, userId int, role string) error {
+	query := "UPDATE conversation_members SET role = $1 WHERE conversation_id = $2 AND user_id = $3"
+	if _, err := tx.Exec(ctx, query, role, conversationId, userId); err != nil {
+		return errors.Wrap(err, "failed to update member role")
+	}
+	return nil
+}
+
+// addMember adds memberId on behalf of userId, who has to be friends with them.
+// Nobody joins a group where they and a member have a block between them.
+// Blocking someone later does not remove either user from the groups they
+// share: both keep seeing each other's messages there until one of them
+// leaves.
+func addMember(ctx context.Context, tx pgx.Tx, conversationId int, memberId int, userId int, role string) error {
+	var exist bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", memberId).Scan(&exist); err != nil {
+		return errors.Wrap(err, "failed check user exist")
+	}
+	if !exist {
+		return ErrUserNotFound
+	}
+	if memberId != userId {
+		friend, err := isFriend(ctx, tx, memberId, userId)
+		if err != nil {
+			return err
+		}
+		if !friend {
+			return ErrNotFriend
+		}
+	}
+
+	var blocked bool
+	query := `
+		SELECT EXISTS (
+		    SELECT 1
+		    FROM conversation_members cm
+		    JOIN user_blocks b ON (b.user_id = cm.user_id AND b.target_id = $2)
+		        OR (b.user_id = $2 AND b.target_id = cm.user_id)
+		    WHERE cm.conversation_id = $1
+		)
+	`
+	if err := tx.QueryRow(ctx, query, conversationId, memberId).Scan(&blocked); err != nil {
+		return errors.Wrap(err, "failed check block exist")
+	}
+	if blocked {
+		return ErrBlockedMember
+	}
+
+	query = `
+		INSERT INTO conversation_members (conversation_id, user_id, role, last_read_message_id)
+		VALUES ($1, $2, $3, COALESCE((SELECT last_message_id FROM conversations WHERE id = $1), 0))
+		ON CONFLICT DO NOTHING
+	`
+	tag, err := tx.Exec(ctx, query, conversationId, memberId, role)
+	if err != nil {
+		return errors.Wrap(err, "failed to add conversation member")
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAlreadyMember
+	}
+	return nil
+}
+
+// CreateGroup starts a group owned by userId with their friends in
+// data.MemberIds.
+func (cs *ConversationStore) CreateGroup(ctx context.Context, data *model.GroupData, userId int) (*model.ConversationResponseData, error) {
+	tx, err := cs.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	change := groupChange{}
+	query := `
+		INSERT INTO conversations (is_group, title, avatar_url)
+		VALUES (TRUE, $1, $2)
+		RETURNING id
+	`
+	if err := tx.QueryRow(ctx, query, data.Title, data.AvatarUrl).Scan(&change.conversationId); err != nil {
+		return nil, errors.Wrap(err, "failed to create conversation")
+	}
+
+	if err := addMember(ctx, tx, change.conversationId, userId, userId, model.ConversationRoleOwner); err != nil {
+		return nil, err
+	}
+	if err := change.systemMessage(ctx, tx, model.MessageGroupCreated, userId, userId); err != nil {
+		return nil, err
+	}
+	for _, memberId := range data.MemberIds {
+		if memberId == userId {
+			continue
+		}
+		err := addMember(ctx, tx, change.conversationId, memberId, userId, model.ConversationRoleMember)
+		if errors.Is(err, ErrAlreadyMember) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := change.systemMessage(ctx, tx, model.MessageMemberAdded, userId, memberId); err != nil {
+			return nil, err
+		}
+	}
+
+	change.recipients, err = memberIds(ctx, tx, change.conversationId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to commit conversation")
+	}
+	cs.publishChange(&change)
+	return cs.GetConversation(ctx, change.conversationId, userId)
+}
+
+// UpdateGroup changes the title or avatar of a group. Only admins and the owner
+// may do so.
+func (cs *ConversationStore) UpdateGroup(ctx context.Context, conversationId int, update *model.GroupUpdate, userId int) (*model.ConversationResponseData, error) {
+	tx, err := cs.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	member, err := lockGroup(ctx, tx, conversationId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if roleRank[member.role] < roleRank[model.ConversationRoleAdmin] {
+		return nil, ErrForbidden
+	}
+
+	query := `
+		UPDATE conversations
+		SET title = COALESCE($1, title), avatar_url = COALESCE($2, avatar_url), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`
+	if _, err := tx.Exec(ctx, query, update.Title, update.AvatarUrl, conversationId); err != nil {
+		return nil, errors.Wrap(err, "failed to update conversation")
+	}
+
+	change := groupChange{conversationId: conversationId}
+	change.recipients, err = memberIds(ctx, tx, conversationId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to commit conversation")
+	}
+	cs.publishChange(&change)
+	return cs.GetConversation(ctx, conversationId, userId)
+}
+
+// InviteMember adds a friend of userId to the group. Only admins and the owner
+// may invite.
+func (cs *ConversationStore) InviteMember(ctx context.Context, conversationId int, memberId int, userId int) error {
+	tx, err := cs.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	member, err := lockGroup(ctx, tx, conversationId, userId)
+	if err != nil {
+		return err
+	}
+	if roleRank[member.role] < roleRank[model.ConversationRoleAdmin] {
+		return ErrForbidden
+	}
+
+	change := groupChange{conversationId: conversationId}
+	if err := addMember(ctx, tx, conversationId, memberId, userId, model.ConversationRoleMember); err != nil {
+		return err
+	}
+	if err := change.systemMessage(ctx, tx, model.MessageMemberAdded, userId, memberId); err != nil {
+		return err
+	}
+	change.recipients, err = memberIds(ctx, tx, conversationId)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit conversation")
+	}
+	cs.publishChange(&change)
+	return nil
+}
+
+// RemoveMember takes memberId out of the group. Admins can remove members, the
+// owner can remove anyone but themselves.
+func (cs *ConversationStore) RemoveMember(ctx context.Context, conversationId int, memberId int, userId int) error {
+	if memberId == userId {
+		return cs.Leave(ctx, conversationId, userId)
+	}
+
+	tx, err := cs.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	member, err := lockGroup(ctx, tx, conversationId, userId)
+	if err != nil {
+		return err
+	}
+	role, err := memberRole(ctx, tx, conversationId, memberId)
+	if err != nil {
+		return err
+	}
+	if roleRank[member.role] < roleRank[model.ConversationRoleAdmin] || roleRank[member.role] <= roleRank[role] {
+		return ErrForbidden
+	}
+
+	change := groupChange{conversationId: conversationId}
+	// The removed member still learns about it from their stream.
+	change.recipients, err = memberIds(ctx, tx, conversationId)
+	if err != nil {
+		return err
+	}
+
+	query := "DELETE FROM conversation_members WHERE conversation_id = $1 AND user_id = $2"
+	if _, err := tx.Exec(ctx, query, conversationId, memberId); err != nil {
+		return errors.Wrap(err, "failed to remove conversation member")
+	}
+	if err := change.systemMessage(ctx, tx, model.MessageMemberRemoved, userId, memberId); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit conversation")
+	}
+	cs.publishChange(&change)
+	return nil
+}
+
+// Leave takes userId out of the group. The owner has to hand the group over
+// first unless they are its last member, in which case the group is deleted.
+func (cs *ConversationStore) Leave(ctx context.Context, conversationId int, userId int) error {
+	tx, err := cs.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	member, err := lockGroup(ctx, tx, conversationId, userId)
+	if err != nil {
+		return err
+	}
+
+	change := groupChange{conversationId: conversationId}
+	change.recipients, err = memberIds(ctx, tx, conversationId)
+	if err != nil {
+		return err
+	}
+
+	if len(change.recipients) == 1 {
+		if _, err := tx.Exec(ctx, "DELETE FROM conversations WHERE id = $1", conversationId); err != nil {
+			return errors.Wrap(err, "failed to delete conversation")
+		}
+	} else {
+		if member.role == model.ConversationRoleOwner {
+			return ErrOwnerMustTransfer
+		}
+		query := "DELETE FROM conversation_members WHERE conversation_id = $1 AND user_id = $2"
+		if _, err := tx.Exec(ctx, query, conversationId, userId); err != nil {
+			return errors.Wrap(err, "failed to remove conversation member")
+		}
+		if err := change.systemMessage(ctx, tx, model.MessageMemberLeft, userId, userId); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit conversation")
+	}
+	cs.publishChange(&change)
+	return nil
+}
+
+// TransferOwnership hands the group from its owner to another member. The
+// previous owner stays on as an admin.
+func (cs *ConversationStore) TransferOwnership(ctx context.Context, conversationId int, memberId int, userId int) error {
+	tx, err := cs.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	member, err := lockGroup(ctx, tx, conversationId, userId)
+	if err != nil {
+		return err
+	}
+	if member.role != model.ConversationRoleOwner {
+		return ErrForbidden
+	}
+	if memberId == userId {
+		return nil
+	}
+	if _, err := memberRole(ctx, tx, conversationId, memberId); err != nil {
+		return err
+	}
+
+	if err := setRole(ctx, tx, conversationId, memberId, model.ConversationRoleOwner); err != nil {
+		return err
+	}
+	if err := setRole(ctx, tx, conversationId, userId, model.ConversationRoleAdmin); err != nil {
+		return err
+	}
+
+	change := groupChange{conversationId: conversationId}
+	if err := change.systemMessage(ctx, tx, model.MessageOwnerChanged, userId, memberId); err != nil {
+		return err
+	}
+	change.recipients, err = memberIds(ctx, tx, conversationId)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit conversation")
+	}
+	cs.publishChange(&change)
+	return nil
+}
+
+// SetMemberRole promotes a member to admin or demotes an admin. Only the owner
+// may change roles; ownership moves with TransferOwnership.
+func (cs *ConversationStore) SetMemberRole(ctx context.Context, conversationId int, memberId int, role string, userId int) error {
+	tx, err := cs.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	member, err := lockGroup(ctx, tx, conversationId, userId)
+	if err != nil {
+		return err
+	}
+	if member.role != model.ConversationRoleOwner || memberId == userId {
+		return ErrForbidden
+	}
+	if _, err := memberRole(ctx, tx, conversationId, memberId); err != nil {
+		return err
+	}
+	if err := setRole(ctx, tx, conversationId, memberId, role); err != nil {
+		return err
+	}
+
+	change := groupChange{conversationId: conversationId}
+	change.recipients, err = memberIds(ctx, tx, conversationId)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit conversation")
+	}
+	cs.publishChange(&change)
+	return nil
+}
+
+// Mute silences a conversation for userId until the given time, or unmutes it
+// when until is nil. It works for one-to-one conversations as well. The server
+// only keeps the setting: messages of a muted conversation are still delivered
+// live and counted as unread, and clients use mutedUntil to keep quiet about
+// them.
+func (cs *ConversationStore) Mute(ctx context.Context, conversationId int, until *time.Time, userId int) error {
+	query := `
+		UPDATE conversation_members SET muted_until = $1
+		WHERE conversation_id = $2 AND user_id = $3
+	`
+	tag, err := cs.db.Exec(ctx, query, until, conversationId, userId)
+	if err != nil {
+		return errors.Wrap(err, "failed to mute conversation")
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrConversationNotFound
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/billymosis/socialmedia-app/helper"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/store/relation"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+// previewActors is the number of most recent actors returned with every
+// notification group.
+const previewActors = 3
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// Querier is satisfied by both *pgxpool.Pool and pgx.Tx so that other stores
+// can record notifications inside their own transactions.
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type NotificationStore struct {
+	db       *pgxpool.Pool
+	Validate *validator.Validate
+}
+
+func NewNotificationStore(db *pgxpool.Pool, validate *validator.Validate) *NotificationStore {
+	return &NotificationStore{
+		db:       db,
+		Validate: validate,
+	}
+}
+
+// Push records event for its recipient. An unread notification of the same type
+// on the same target absorbs the event instead of creating a new row. Events a
+// user triggers on their own content are ignored.
+func Push(ctx context.Context, q Querier, event model.NotificationEvent) error {
+	if event.UserId == event.ActorId {
+		return nil
+	}
+
+	var id int
+	query := `
+		INSERT INTO notifications (user_id, type, target_id, last_actor_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, type, target_id) WHERE read_at IS NULL
+		DO UPDATE SET last_actor_id = EXCLUDED.last_actor_id, updated_at = CURRENT_TIMESTAMP
+		RETURNING id
+	`
+	err := q.QueryRow(ctx, query, event.UserId, event.Type, event.TargetId, event.ActorId).Scan(&id)
+	if err != nil {
+		return errors.Wrap(err, "failed to create notification")
+	}
+
+	query = `
+		INSERT INTO notification_actors (notification_id, actor_id)
+		VALUES ($1, $2)
+		ON CONFLICT (notification_id, actor_id) DO UPDATE SET created_at = CURRENT_TIMESTAMP
+	`
+	if _, err := q.Exec(ctx, query, id, event.ActorId); err != nil {
+		return errors.Wrap(err, "failed to add notification actor")
+	}
+
+	query = `
+		UPDATE notifications
+		SET actor_count = (SELECT COUNT(*) FROM notification_actors WHERE notification_id = $1)
+		WHERE id = $1
+	`
+	if _, err := q.Exec(ctx, query, id); err != nil {
+		return errors.Wrap(err, "failed to update notification")
+	}
+	return nil
+}
+
+func (ns *NotificationStore) UnreadCount(ctx context.Context, userId int) (int, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL"
+	if err := ns.db.QueryRow(ctx, query, userId).Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "failed to count notifications")
+	}
+	return count, nil
+}
+
+func (ns *NotificationStore) GetNotificationList(ctx context.Context, userId int, queryParams url.Values) (*model.NotificationResponse, error) {
+	limit, err := helper.CursorLimit(queryParams.Get("limit"), 20, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	q := helper.Query{}
+	q.Query(`
+		SELECT id, type, target_id, actor_count, read_at, created_at, updated_at
+		FROM notifications
+		WHERE user_id = `)
+	q.Param(userId)
+	if onlyUnread, _ := strconv.ParseBool(queryParams.Get("unread")); onlyUnread {
+		q.Query(" AND read_at IS NULL")
+	}
+	if cursor := queryParams.Get("cursor"); cursor != "" {
+		updatedAt, cursorId, err := helper.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		q.Query(" AND (updated_at, id) < (")
+		q.Param(updatedAt)
+		q.Query(", ")
+		q.Param(cursorId)
+		q.Query(")")
+	}
+	q.Query(" ORDER BY updated_at DESC, id DESC LIMIT ")
+	q.Param(limit + 1)
+	query, params := q.Get()
+
+	rows, err := ns.db.Query(ctx, query, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get notifications")
+	}
+	defer rows.Close()
+
+	notifications := make([]model.Notification, 0)
+	for rows.Next() {
+		var n model.Notification
+		err := rows.Scan(&n.Id, &n.Type, &n.TargetId, &n.ActorCount, &n.ReadAt, &n.CreatedAt, &n.UpdatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan notification")
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+
+	res := model.NotificationResponse{
+		Data: []model.NotificationResponseData{},
+	}
+	res.Meta.Limit = limit
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		last := notifications[len(notifications)-1]
+		res.Meta.NextCursor = helper.EncodeCursor(last.UpdatedAt, last.Id)
+	}
+
+	ids := make([]int, 0, len(notifications))
+	for _, n := range notifications {
+		ids = append(ids, n.Id)
+	}
+	actors, err := ns.loadActors(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	var creators []*model.CreatorValid
+	for id := range actors {
+		for i := range actors[id] {
+			creators = append(creators, &actors[id][i])
+		}
+	}
+	if err := relation.Annotate(ctx, ns.db, userId, creators); err != nil {
+		return nil, err
+	}
+
+	for _, n := range notifications {
+		if actors[n.Id] == nil {
+			actors[n.Id] = []model.CreatorValid{}
+		}
+		res.Data = append(res.Data, model.NotificationResponseData{
+			NotificationId: strconv.Itoa(n.Id),
+			Type:           n.Type,
+			TargetId:       strconv.Itoa(n.TargetId),
+			Message:        describe(n, actors[n.Id]),
+			ActorCount:     n.ActorCount,
+			Actors:         actors[n.Id],
+			Read:           n.ReadAt != nil,
+			CreatedAt:      n.CreatedAt,
+			UpdatedAt:      n.UpdatedAt,
+		})
+	}
+
+	res.Meta.UnreadCount, err = ns.UnreadCount(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// loadActors returns the most recent actors of every notification in ids.
+func (ns *NotificationStore) loadActors(ctx context.Context, ids []int) (map[int][]model.CreatorValid, error) {
+	actors := make(map[int][]model.CreatorValid)
+	if len(ids) == 0 {
+		return actors, nil
+	}
+	query := `
+		SELECT na.notification_id, u.id, u.name, u.image_url, u.friend_count, u.created_at
+		FROM (
+		    SELECT *, ROW_NUMBER() OVER (PARTITION BY notification_id ORDER BY created_at DESC) AS rn
+		    FROM notification_actors
+		    WHERE notification_id = ANY($1)
+		) na
+		JOIN users u ON u.id = na.actor_id
+		WHERE na.rn <= $2
+		ORDER BY na.notification_id, na.created_at DESC
+	`
+	rows, err := ns.db.Query(ctx, query, ids, previewActors)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get notification actors")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var actor model.CreatorValid
+		var imageUrl sql.NullString
+		if err := rows.Scan(&id, &actor.UserId, &actor.Name, &imageUrl, &actor.FriendCount, &actor.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan notification actor")
+		}
+		actor.ImageURL = imageUrl.String
+		actors[id] = append(actors[id], actor)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	return actors, nil
+}
+
+// describe renders the grouped summary shown to the user, for example
+// "Jane and 4 others commented on your post".
+func describe(n model.Notification, actors []model.CreatorValid) string {
+	who := "Someone"
+	if len(actors) > 0 {
+		who = actors[0].Name
+	}
+	switch {
+	case n.ActorCount == 2:
+		who = fmt.Sprintf("%s and 1 other", who)
+	case n.ActorCount > 2:
+		who = fmt.Sprintf("%s and %d others", who, n.ActorCount-1)
+	}
+
+	switch n.Type {
+	case model.NotificationComment:
+		return who + " commented on your post"
+	case model.NotificationReply:
+		return who + " replied to your comment"
+	case model.NotificationReaction:
+		return who + " reacted to your post"
+	case model.NotificationCommentReact:
+		return who + " reacted to your comment"
+	case model.NotificationFriendRequest:
+		return who + " sent you a friend request"
+	case model.NotificationFriendAccept:
+		return who + " accepted your friend request"
+	case model.NotificationMention:
+		return who + " mentioned you in a post"
+	case model.NotificationCommentMention:
+		return who + " mentioned you in a comment"
+	case model.NotificationFollow:
+		return who + " started following you"
+	case model.NotificationFollowRequest:
+		return who + " asked to follow you"
+	case model.NotificationFollowAccept:
+		return who + " accepted your follow request"
+	default:
+		return who + " interacted with you"
+	}
+}
+
+func (ns *NotificationStore) MarkRead(ctx context.Context, notificationId int, userId int) error {
+	query := `
+		UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND read_at IS NULL
+	`
+	tag, err := ns.db.Exec(ctx, query, notificationId, userId)
+	if err != nil {
+		return errors.Wrap(err, "failed to mark notification read")
+	}
+	if tag.RowsAffected() == 0 {
+		var exist bool
+		query = "SELECT EXISTS (SELECT 1 FROM notifications WHERE id = $1 AND user_id = $2)"
+		if err := ns.db.QueryRow(ctx, query, notificationId, userId).Scan(&exist); err != nil {
+			return errors.Wrap(err, "failed check notification exist")
+		}
+		if !exist {
+			return ErrNotificationNotFound
+		}
+	}
+	return nil
+}
+
+func (ns *NotificationStore) MarkAllRead(ctx context.Context, userId int) error {
+	query := `
+		UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+	_, err := ns.db.Exec(ctx, query, userId)
+	if err != nil {
+		return errors.Wrap(err, "failed to mark notifications read")
+	}
+	return nil
+}
@@ -0,0 +1,494 @@
+package post
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/billymosis/socialmedia-app/helper"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/markup"
+	"github.com/billymosis/socialmedia-app/service/realtime"
+	"github.com/billymosis/socialmedia-app/store/notification"
+	"github.com/billymosis/socialmedia-app/store/relation"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// feedCommentLimit is the number of newest comments embedded in every post of a
+// list. The full thread is available from GetComments.
+const feedCommentLimit = 3
+
+const commentColumns = `
+		SELECT c.id, c.comment, c.post_id, c.user_id, c.parent_comment_id, c.created_at, c.updated_at, c.reaction_counts,
+		u.id, u.name, u.image_url, u.friend_count, u.created_at`
+
+func scanComment(row pgx.Row) (*model.CommentAndUser, error) {
+	var mod model.CommentAndUser
+	var imageUrl sql.NullString
+	var reactionsJSON []byte
+	err := row.Scan(&mod.Comment.Id, &mod.Comment.Comment, &mod.Comment.PostId, &mod.Comment.UserId, &mod.Comment.ParentCommentId, &mod.Comment.CreatedAt, &mod.Comment.UpdatedAt, &reactionsJSON, &mod.Creator.UserId, &mod.Creator.Name, &imageUrl, &mod.Creator.FriendCount, &mod.Creator.CreatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan comments")
+	}
+	mod.Creator.ImageURL = imageUrl.String
+	mod.Reactions, err = decodeReactionCounts(reactionsJSON)
+	if err != nil {
+		return nil, err
+	}
+	return &mod, nil
+}
+
+func toCommentResponse(el *model.CommentAndUser, mine map[int]string) model.CommentResponseValid {
+	comment := model.CommentResponseValid{
+		CommentId: strconv.Itoa(el.Comment.Id),
+		Comment:   el.Comment.Comment,
+		Creator:   el.Creator,
+		Reactions: el.Reactions,
+		CreatedAt: el.Comment.CreatedAt,
+		UpdatedAt: el.Comment.UpdatedAt,
+	}
+	if el.Comment.ParentCommentId != nil {
+		parentId := strconv.Itoa(*el.Comment.ParentCommentId)
+		comment.ParentCommentId = &parentId
+	}
+	if kind, ok := mine[el.Comment.Id]; ok {
+		comment.MyReaction = &kind
+	}
+	return comment
+}
+
+func (ps *PostStore) queryComments(ctx context.Context, query string, params ...interface{}) ([]*model.CommentAndUser, error) {
+	rows, err := ps.db.Query(ctx, query, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get comments")
+	}
+	defer rows.Close()
+
+	comments := make([]*model.CommentAndUser, 0)
+	for rows.Next() {
+		mod, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, mod)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	return comments, nil
+}
+
+// CreateComment sanitizes and stores a comment, and notifies the owner of the
+// post, the author of the comment it replies to and the users it mentions.
+// Hashtags and mentions become links like in posts, but the hashtags are not
+// added to the tags of the post, which are up to its owner.
+func (ps *PostStore) CreateComment(ctx context.Context, comment *model.Comment, userId int) error {
+	comment.Comment = markup.Sanitize(comment.Comment)
+	if strings.TrimSpace(comment.Comment) == "" {
+		return ErrEmptyContent
+	}
+
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockPost(ctx, tx, comment.PostId, userId); err != nil {
+		if errors.Is(err, ErrPostNotFound) {
+			return err
+		}
+		return errors.Wrap(err, "failed check post exist")
+	}
+
+	var ownerId int
+	if err := tx.QueryRow(ctx, "SELECT user_id FROM posts WHERE id = $1", comment.PostId).Scan(&ownerId); err != nil {
+		return errors.Wrap(err, "failed to get post owner")
+	}
+
+	var parentAuthorId int
+	if comment.ParentCommentId != nil {
+		query := `
+			SELECT user_id
+			FROM comments
+			WHERE id = $1 AND post_id = $2 AND deleted_at IS NULL
+		`
+		err := tx.QueryRow(ctx, query, *comment.ParentCommentId, comment.PostId).Scan(&parentAuthorId)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrCommentNotFound
+			}
+			return errors.Wrap(err, "failed check comment exist")
+		}
+	}
+
+	var mentioned map[string]int
+	comment.Comment, mentioned, _, err = linkContent(ctx, tx, comment.Comment, userId)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO comments
+		(comment, post_id, user_id, parent_comment_id)
+		VALUES($1,$2,$3,$4)
+		RETURNING id, created_at
+	`
+	err = tx.QueryRow(ctx, query, comment.Comment, comment.PostId, userId, comment.ParentCommentId).Scan(&comment.Id, &comment.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to create comments")
+	}
+	comment.UserId = userId
+
+	_, err = tx.Exec(ctx, "UPDATE posts SET comment_count = comment_count + 1 WHERE id = $1", comment.PostId)
+	if err != nil {
+		return errors.Wrap(err, "failed to update comment count")
+	}
+
+	var notifications []model.NotificationEvent
+	if comment.ParentCommentId != nil {
+		notifications = append(notifications, model.NotificationEvent{
+			UserId:   parentAuthorId,
+			ActorId:  userId,
+			Type:     model.NotificationReply,
+			TargetId: *comment.ParentCommentId,
+		})
+	}
+	if comment.ParentCommentId == nil || parentAuthorId != ownerId {
+		notifications = append(notifications, model.NotificationEvent{
+			UserId:   ownerId,
+			ActorId:  userId,
+			Type:     model.NotificationComment,
+			TargetId: comment.PostId,
+		})
+	}
+	for _, event := range notifications {
+		if err := notification.Push(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+	mentions, err := saveCommentMentions(ctx, tx, comment.PostId, comment.Id, mentioned, userId)
+	if err != nil {
+		return err
+	}
+	notifications = append(notifications, mentions...)
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit comment")
+	}
+
+	if ownerId != userId {
+		created := realtime.CommentCreated{
+			CommentId: strconv.Itoa(comment.Id),
+			PostId:    strconv.Itoa(comment.PostId),
+			CreatorId: strconv.Itoa(userId),
+		}
+		if comment.ParentCommentId != nil {
+			parentId := strconv.Itoa(*comment.ParentCommentId)
+			created.ParentCommentId = &parentId
+		}
+		ps.events.Publish(ownerId, realtime.EventCommentCreated, created)
+	}
+	ps.events.Notify(notifications...)
+	return nil
+}
+
+// loadComments embeds the newest comments of every post in posts, the
+// reactions userId left on both and how userId relates to their authors, with
+// one query per kind of data.
+func (ps *PostStore) loadComments(ctx context.Context, posts []*model.PostResponseData, userId int) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	postIds := make([]int, 0, len(posts))
+	for _, post := range posts {
+		id, err := strconv.Atoi(post.PostID)
+		if err != nil {
+			return errors.Wrap(err, "failed to convert")
+		}
+		postIds = append(postIds, id)
+	}
+
+	query := commentColumns + `
+		FROM (
+		    SELECT *, ROW_NUMBER() OVER (PARTITION BY post_id ORDER BY created_at DESC, id DESC) AS rn
+		    FROM comments
+		    WHERE post_id = ANY($1) AND deleted_at IS NULL
+		) c
+		LEFT JOIN users u ON c.user_id = u.id
+		WHERE c.rn <= $2
+		ORDER BY c.created_at, c.id
+	`
+	rows, err := ps.queryComments(ctx, query, postIds, feedCommentLimit)
+	if err != nil {
+		return err
+	}
+
+	var comments = make(map[int][]*model.CommentAndUser, 0)
+	var commentIds []int
+	for _, mod := range rows {
+		comments[mod.Comment.PostId] = append(comments[mod.Comment.PostId], mod)
+		commentIds = append(commentIds, mod.Comment.Id)
+	}
+
+	myPostReactions, err := ps.myReactions(ctx, postReaction, postIds, userId)
+	if err != nil {
+		return err
+	}
+	myCommentReactions, err := ps.myReactions(ctx, commentReaction, commentIds, userId)
+	if err != nil {
+		return err
+	}
+
+	for i, post := range posts {
+		if kind, ok := myPostReactions[postIds[i]]; ok {
+			post.MyReaction = &kind
+		}
+		post.Comments = make([]model.CommentResponseValid, 0)
+		for _, el := range comments[postIds[i]] {
+			post.Comments = append(post.Comments, toCommentResponse(el, myCommentReactions))
+		}
+	}
+
+	var creators []*model.CreatorValid
+	for _, post := range posts {
+		creators = append(creators, &post.Creator)
+		creators = append(creators, commentCreators(post.Comments)...)
+	}
+	return relation.Annotate(ctx, ps.db, userId, creators)
+}
+
+// commentCreators returns the authors of comments and of all their replies.
+func commentCreators(comments []model.CommentResponseValid) []*model.CreatorValid {
+	var creators []*model.CreatorValid
+	for i := range comments {
+		creators = append(creators, &comments[i].Creator)
+		creators = append(creators, commentCreators(comments[i].Replies)...)
+	}
+	return creators
+}
+
+type commentNode struct {
+	comment model.CommentResponseValid
+	replies []*commentNode
+}
+
+func (n *commentNode) response() model.CommentResponseValid {
+	comment := n.comment
+	for _, reply := range n.replies {
+		comment.Replies = append(comment.Replies, reply.response())
+	}
+	return comment
+}
+
+// GetComments pages through the top level comments of a post, oldest first,
+// and nests every reply below the comment it answers.
+func (ps *PostStore) GetComments(ctx context.Context, postId int, userId int, queryParams url.Values) (*model.CommentListResponse, error) {
+	limit, err := helper.CursorLimit(queryParams.Get("limit"), 10, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	q := helper.Query{}
+	q.Query("SELECT p.id FROM posts p WHERE p.deleted_at IS NULL AND p.id = ")
+	q.Param(postId)
+	visibleTo(&q, userId)
+	query, params := q.Get()
+	var id int
+	if err := ps.db.QueryRow(ctx, query, params...).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPostNotFound
+		}
+		return nil, errors.Wrap(err, "failed to get post")
+	}
+
+	q = helper.Query{}
+	q.Query(commentColumns)
+	q.Query(`
+		FROM comments c
+		LEFT JOIN users u ON c.user_id = u.id
+		WHERE c.deleted_at IS NULL AND c.parent_comment_id IS NULL AND c.post_id = `)
+	q.Param(postId)
+	if cursor := queryParams.Get("cursor"); cursor != "" {
+		createdAt, cursorId, err := helper.DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		q.Query(" AND (c.created_at, c.id) > (")
+		q.Param(createdAt)
+		q.Query(", ")
+		q.Param(cursorId)
+		q.Query(")")
+	}
+	q.Query(" ORDER BY c.created_at, c.id LIMIT ")
+	q.Param(limit + 1)
+	query, params = q.Get()
+	top, err := ps.queryComments(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := model.CommentListResponse{
+		Data: []model.CommentResponseValid{},
+		Meta: model.CursorMeta{Limit: limit},
+	}
+	if len(top) > limit {
+		top = top[:limit]
+		last := top[len(top)-1].Comment
+		res.Meta.NextCursor = helper.EncodeCursor(last.CreatedAt, last.Id)
+	}
+	if len(top) == 0 {
+		return &res, nil
+	}
+
+	topIds := make([]int, 0, len(top))
+	for _, el := range top {
+		topIds = append(topIds, el.Comment.Id)
+	}
+	query = `
+		WITH RECURSIVE thread AS (
+		    SELECT id FROM comments WHERE parent_comment_id = ANY($1) AND deleted_at IS NULL
+		    UNION ALL
+		    SELECT c.id FROM comments c
+		    JOIN thread t ON c.parent_comment_id = t.id
+		    WHERE c.deleted_at IS NULL
+		)` + commentColumns + `
+		FROM comments c
+		LEFT JOIN users u ON c.user_id = u.id
+		WHERE c.id IN (SELECT id FROM thread)
+		ORDER BY c.created_at, c.id
+	`
+	replies, err := ps.queryComments(ctx, query, topIds)
+	if err != nil {
+		return nil, err
+	}
+
+	all := append(top, replies...)
+	allIds := make([]int, 0, len(all))
+	for _, el := range all {
+		allIds = append(allIds, el.Comment.Id)
+	}
+	mine, err := ps.myReactions(ctx, commentReaction, allIds, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int]*commentNode, len(all))
+	for _, el := range all {
+		nodes[el.Comment.Id] = &commentNode{comment: toCommentResponse(el, mine)}
+	}
+	for _, el := range replies {
+		if parent, ok := nodes[*el.Comment.ParentCommentId]; ok {
+			parent.replies = append(parent.replies, nodes[el.Comment.Id])
+		}
+	}
+	for _, el := range top {
+		res.Data = append(res.Data, nodes[el.Comment.Id].response())
+	}
+	if err := relation.Annotate(ctx, ps.db, userId, commentCreators(res.Data)); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// commentPermission reports whether userId may change a comment: its author
+// and the owner of the post it belongs to both can.
+func (ps *PostStore) commentPermission(ctx context.Context, commentId int, userId int) (int, error) {
+	var postId, authorId, ownerId int
+	query := `
+		SELECT c.post_id, c.user_id, p.user_id
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		WHERE c.id = $1 AND c.deleted_at IS NULL AND p.deleted_at IS NULL
+	`
+	err := ps.db.QueryRow(ctx, query, commentId).Scan(&postId, &authorId, &ownerId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrCommentNotFound
+		}
+		return 0, errors.Wrap(err, "failed to get comment")
+	}
+	if userId != authorId && userId != ownerId {
+		return 0, ErrForbidden
+	}
+	return postId, nil
+}
+
+func (ps *PostStore) UpdateComment(ctx context.Context, commentId int, text string, userId int) error {
+	text = markup.Sanitize(text)
+	if strings.TrimSpace(text) == "" {
+		return ErrEmptyContent
+	}
+	postId, err := ps.commentPermission(ctx, commentId, userId)
+	if err != nil {
+		return err
+	}
+
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	var authorId int
+	query := "SELECT user_id FROM comments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE"
+	if err := tx.QueryRow(ctx, query, commentId).Scan(&authorId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrCommentNotFound
+		}
+		return errors.Wrap(err, "failed to get comment")
+	}
+
+	// The post owner may edit the comment too, but the mentions are still the
+	// author's.
+	text, mentioned, _, err := linkContent(ctx, tx, text, authorId)
+	if err != nil {
+		return err
+	}
+
+	query = "UPDATE comments SET comment = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2"
+	if _, err := tx.Exec(ctx, query, text, commentId); err != nil {
+		return errors.Wrap(err, "failed to update comment")
+	}
+
+	notifications, err := saveCommentMentions(ctx, tx, postId, commentId, mentioned, authorId)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit comment")
+	}
+	ps.events.Notify(notifications...)
+	return nil
+}
+
+// DeleteComment soft deletes a comment together with every reply below it.
+func (ps *PostStore) DeleteComment(ctx context.Context, commentId int, userId int) error {
+	postId, err := ps.commentPermission(ctx, commentId, userId)
+	if err != nil {
+		return err
+	}
+	query := `
+		WITH RECURSIVE thread AS (
+		    SELECT id FROM comments WHERE id = $1
+		    UNION ALL
+		    SELECT c.id FROM comments c
+		    JOIN thread t ON c.parent_comment_id = t.id
+		), deleted AS (
+		    UPDATE comments SET deleted_at = CURRENT_TIMESTAMP
+		    WHERE id IN (SELECT id FROM thread) AND deleted_at IS NULL
+		    RETURNING id
+		)
+		UPDATE posts
+		SET comment_count = GREATEST(comment_count - (SELECT COUNT(*) FROM deleted), 0)
+		WHERE id = $2
+	`
+	_, err = ps.db.Exec(ctx, query, commentId, postId)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete comment")
+	}
+	return nil
+}
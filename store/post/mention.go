@@ -0,0 +1,192 @@
+package post
+
+import (
+	"context"
+	"strings"
+
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/markup"
+	"github.com/billymosis/socialmedia-app/store/notification"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// resolveMentions maps the lower cased handles to the users they belong to.
+// Handles of users who blocked authorId, or were blocked by them, are dropped.
+func resolveMentions(ctx context.Context, tx pgx.Tx, handles []string, authorId int) (map[string]int, error) {
+	users := make(map[string]int)
+	if len(handles) == 0 {
+		return users, nil
+	}
+	query := `
+		SELECT LOWER(u.handle), u.id
+		FROM users u
+		WHERE LOWER(u.handle) = ANY($1)
+		AND NOT EXISTS (
+		    SELECT 1 FROM user_blocks b
+		    WHERE (b.user_id = u.id AND b.target_id = $2) OR (b.user_id = $2 AND b.target_id = u.id)
+		)
+	`
+	rows, err := tx.Query(ctx, query, handles, authorId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve mentions")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var handle string
+		var id int
+		if err := rows.Scan(&handle, &id); err != nil {
+			return nil, errors.Wrap(err, "failed to scan mention")
+		}
+		users[handle] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	return users, nil
+}
+
+// linkContent turns the hashtags of sanitized HTML, and its mentions of the
+// users authorId may mention, into links. It returns the linked HTML together
+// with the users mentioned and the hashtags used.
+func linkContent(ctx context.Context, tx pgx.Tx, html string, authorId int) (string, map[string]int, []string, error) {
+	handles, hashtags := markup.Extract(html)
+	mentioned, err := resolveMentions(ctx, tx, handles, authorId)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return markup.Sanitize(markup.Link(html, mentioned)), mentioned, hashtags, nil
+}
+
+// saveMentions makes users the mentions of a post, or of one of its comments
+// when commentId is set, and returns the users who were not mentioned there
+// before.
+func saveMentions(ctx context.Context, tx pgx.Tx, postId int, commentId *int, users map[string]int) ([]int, error) {
+	userIds := make([]int, 0, len(users))
+	for _, id := range users {
+		userIds = append(userIds, id)
+	}
+
+	var err error
+	var insertQuery string
+	if commentId == nil {
+		query := "DELETE FROM post_mentions WHERE post_id = $1 AND comment_id IS NULL AND user_id <> ALL($2)"
+		_, err = tx.Exec(ctx, query, postId, userIds)
+		insertQuery = `
+			INSERT INTO post_mentions (post_id, user_id)
+			SELECT $1, UNNEST($2::int[])
+			ON CONFLICT (post_id, user_id) WHERE comment_id IS NULL DO NOTHING
+			RETURNING user_id
+		`
+	} else {
+		query := "DELETE FROM post_mentions WHERE comment_id = $1 AND user_id <> ALL($2)"
+		_, err = tx.Exec(ctx, query, *commentId, userIds)
+		insertQuery = `
+			INSERT INTO post_mentions (post_id, comment_id, user_id)
+			SELECT $1, $3, UNNEST($2::int[])
+			ON CONFLICT (comment_id, user_id) WHERE comment_id IS NOT NULL DO NOTHING
+			RETURNING user_id
+		`
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to delete mentions")
+	}
+
+	params := []interface{}{postId, userIds}
+	if commentId != nil {
+		params = append(params, *commentId)
+	}
+	rows, err := tx.Query(ctx, insertQuery, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to add mentions")
+	}
+	added, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan mentions")
+	}
+	return added, nil
+}
+
+// mentionNotifications tells the users in userIds who are allowed to read the
+// post that actorId mentioned them.
+func mentionNotifications(ctx context.Context, tx pgx.Tx, postId int, userIds []int, actorId int, kind string, targetId int) ([]model.NotificationEvent, error) {
+	if len(userIds) == 0 {
+		return nil, nil
+	}
+	query := `
+		SELECT u.id
+		FROM users u
+		JOIN posts p ON p.id = $1
+		WHERE u.id = ANY($2)
+		AND (
+		    p.user_id = u.id OR p.visibility = 'public' OR (p.visibility = 'friends' AND EXISTS (
+		        SELECT 1 FROM relationships r
+		        WHERE (r.user_first_id = p.user_id AND r.user_second_id = u.id)
+		        OR (r.user_second_id = p.user_id AND r.user_first_id = u.id)
+		    ))
+		)
+		AND NOT EXISTS (
+		    SELECT 1 FROM user_blocks b
+		    WHERE (b.user_id = u.id AND b.target_id = p.user_id) OR (b.user_id = p.user_id AND b.target_id = u.id)
+		)
+	`
+	rows, err := tx.Query(ctx, query, postId, userIds)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check mention visibility")
+	}
+	readers, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan mention visibility")
+	}
+
+	var events []model.NotificationEvent
+	for _, userId := range readers {
+		event := model.NotificationEvent{
+			UserId:   userId,
+			ActorId:  actorId,
+			Type:     kind,
+			TargetId: targetId,
+		}
+		if err := notification.Push(ctx, tx, event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// savePostMentions records who the post mentions and notifies those mentioned
+// for the first time.
+func savePostMentions(ctx context.Context, tx pgx.Tx, postId int, users map[string]int, authorId int) ([]model.NotificationEvent, error) {
+	added, err := saveMentions(ctx, tx, postId, nil, users)
+	if err != nil {
+		return nil, err
+	}
+	return mentionNotifications(ctx, tx, postId, added, authorId, model.NotificationMention, postId)
+}
+
+// saveCommentMentions does the same as savePostMentions for a comment.
+func saveCommentMentions(ctx context.Context, tx pgx.Tx, postId int, commentId int, users map[string]int, authorId int) ([]model.NotificationEvent, error) {
+	added, err := saveMentions(ctx, tx, postId, &commentId, users)
+	if err != nil {
+		return nil, err
+	}
+	return mentionNotifications(ctx, tx, postId, added, authorId, model.NotificationCommentMention, commentId)
+}
+
+// mergeTags adds the hashtags that are not among tags yet.
+func mergeTags(tags []string, hashtags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	merged := make([]string, 0, len(tags)+len(hashtags))
+	for _, tag := range tags {
+		seen[strings.ToLower(tag)] = true
+		merged = append(merged, tag)
+	}
+	for _, tag := range hashtags {
+		if !seen[tag] {
+			seen[tag] = true
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
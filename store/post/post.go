@@ -11,75 +11,370 @@ import (
 
 	"github.com/billymosis/socialmedia-app/helper"
 	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/markup"
+	"github.com/billymosis/socialmedia-app/service/realtime"
 	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
 )
 
+var (
+	ErrPostNotFound = errors.New("post not found")
+	ErrForbidden    = errors.New("forbidden")
+	ErrEmptyContent = errors.New("content is empty once unsafe markup is removed")
+)
+
 type PostStore struct {
 	db       *pgxpool.Pool
 	Validate *validator.Validate
+	events   *realtime.Hub
 }
 
-func NewPostStore(db *pgxpool.Pool, validate *validator.Validate) *PostStore {
+func NewPostStore(db *pgxpool.Pool, validate *validator.Validate, events *realtime.Hub) *PostStore {
 	return &PostStore{
 		db:       db,
 		Validate: validate,
+		events:   events,
 	}
 }
 
+// Create stores a post. Its HTML is sanitized, hashtags in it are added to its
+// tags, and they and the mentions of existing users become links.
 func (ps *PostStore) Create(ctx context.Context, post *model.Post, userId int) error {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	html := markup.Sanitize(post.Html)
+	if strings.TrimSpace(html) == "" {
+		return ErrEmptyContent
+	}
+	html, mentioned, hashtags, err := linkContent(ctx, tx, html, userId)
+	if err != nil {
+		return err
+	}
+	post.Html = html
+	post.Tags = mergeTags(post.Tags, hashtags)
+
 	tagsJSON, err := json.Marshal(post.Tags)
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal tags to JSON")
 	}
 	query := `
 	INSERT INTO posts
-	(html, user_id, tags)
-	VALUES($1,$2,$3)
+	(html, user_id, tags, visibility, search_text)
+	VALUES($1,$2,$3,$4,$5)
+	RETURNING id, created_at
 	`
 
-	_, err = ps.db.Exec(ctx, query, post.Html, userId, tagsJSON)
+	err = tx.QueryRow(ctx, query, post.Html, userId, tagsJSON, post.Visibility, markup.Text(post.Html)).Scan(&post.Id, &post.CreatedAt)
 	if err != nil {
 		return errors.Wrap(err, "failed to create posts")
 	}
+	post.UserId = userId
+
+	notifications, err := savePostMentions(ctx, tx, post.Id, mentioned, userId)
+	if err != nil {
+		return err
+	}
+	// The friends are loaded before committing, so that nothing can fail once
+	// the post is stored.
+	var friendIds []int
+	if post.Visibility != model.VisibilityPrivate {
+		friendIds, err = friendsOf(ctx, tx, userId)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit post")
+	}
+	ps.events.Notify(notifications...)
+
+	for _, friendId := range friendIds {
+		ps.events.Publish(friendId, realtime.EventPostCreated, realtime.PostCreated{
+			PostId:     strconv.Itoa(post.Id),
+			CreatorId:  strconv.Itoa(userId),
+			Visibility: post.Visibility,
+		})
+	}
 	return nil
 }
 
-func (ps *PostStore) CreateComment(ctx context.Context, comment *model.Comment, userId int) error {
+func friendsOf(ctx context.Context, tx pgx.Tx, userId int) ([]int, error) {
+	query := `
+		SELECT CASE WHEN user_first_id = $1 THEN user_second_id ELSE user_first_id END
+		FROM relationships
+		WHERE user_first_id = $1 OR user_second_id = $1
+	`
+	rows, err := tx.Query(ctx, query, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get friends")
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan friends")
+	}
+	return ids, nil
+}
+
+// getOwner returns the author of a post that has not been deleted.
+func (ps *PostStore) getOwner(ctx context.Context, postId int) (int, error) {
+	var ownerId int
+	query := "SELECT user_id FROM posts WHERE id = $1 AND deleted_at IS NULL"
+	err := ps.db.QueryRow(ctx, query, postId).Scan(&ownerId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrPostNotFound
+		}
+		return 0, errors.Wrap(err, "failed to get post")
+	}
+	return ownerId, nil
+}
+
+func (ps *PostStore) Update(ctx context.Context, postId int, update *model.PostUpdate, userId int) error {
+	ownerId, err := ps.getOwner(ctx, postId)
+	if err != nil {
+		return err
+	}
+	if ownerId != userId {
+		return ErrForbidden
+	}
+
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	var mentioned map[string]int
+	var searchText *string
+	tags := update.Tags
+	if update.Html != nil {
+		html := markup.Sanitize(*update.Html)
+		if strings.TrimSpace(html) == "" {
+			return ErrEmptyContent
+		}
+		var hashtags []string
+		html, mentioned, hashtags, err = linkContent(ctx, tx, html, userId)
+		if err != nil {
+			return err
+		}
+		update.Html = &html
+		text := markup.Text(html)
+		searchText = &text
+
+		if tags == nil {
+			var currentJSON []byte
+			if err := tx.QueryRow(ctx, "SELECT tags FROM posts WHERE id = $1", postId).Scan(&currentJSON); err != nil {
+				return errors.Wrap(err, "failed to get tags")
+			}
+			if err := json.Unmarshal(currentJSON, &tags); err != nil {
+				return errors.Wrap(err, "failed to unmarshal tags JSON")
+			}
+		}
+		tags = mergeTags(tags, hashtags)
+	}
+
+	var tagsJSON []byte
+	if tags != nil {
+		tagsJSON, err = json.Marshal(tags)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal tags to JSON")
+		}
+	}
 	query := `
-		INSERT INTO comments
-		(comment, post_id, user_id)
-		VALUES($1,$2,$3)
+		UPDATE posts
+		SET html = COALESCE($1, html), tags = COALESCE($2, tags), visibility = COALESCE($3, visibility),
+		    search_text = COALESCE($4, search_text), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5 AND deleted_at IS NULL
 	`
+	_, err = tx.Exec(ctx, query, update.Html, tagsJSON, update.Visibility, searchText, postId)
+	if err != nil {
+		return errors.Wrap(err, "failed to update post")
+	}
+
+	var notifications []model.NotificationEvent
+	if update.Html != nil {
+		notifications, err = savePostMentions(ctx, tx, postId, mentioned, userId)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit post")
+	}
+	ps.events.Notify(notifications...)
+	return nil
+}
+
+func (ps *PostStore) Delete(ctx context.Context, postId int, userId int) error {
+	ownerId, err := ps.getOwner(ctx, postId)
+	if err != nil {
+		return err
+	}
+	if ownerId != userId {
+		return ErrForbidden
+	}
 
-	_, err := ps.db.Exec(ctx, query, comment.Comment, comment.PostId, userId)
+	query := "UPDATE posts SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL"
+	_, err = ps.db.Exec(ctx, query, postId)
 	if err != nil {
-		return errors.Wrap(err, "failed to create comments")
+		return errors.Wrap(err, "failed to delete post")
 	}
 	return nil
 }
 
-func (ps *PostStore) GetPostList(ctx context.Context, queryParams url.Values) (*model.PostResponse, error) {
+const postColumns = `
+		SELECT p.id, p.html, p.tags, p.visibility, p.reaction_counts, p.comment_count, p.created_at, p.updated_at,
+		       u.id post_creator_id, u.name as post_creator_name, u.image_url, u.friend_count, u.created_at`
+
+func scanPost(row pgx.Row) (*model.PostResponseData, error) {
+	var data model.PostResponseData
+	var tagsJSON, reactionsJSON []byte
+	var postUserImage sql.NullString
+	err := row.Scan(&data.PostID, &data.PostContent.PostInHTML, &tagsJSON, &data.PostContent.Visibility, &reactionsJSON, &data.CommentCount, &data.PostContent.CreatedAt, &data.PostContent.UpdatedAt, &data.Creator.UserId, &data.Creator.Name, &postUserImage, &data.Creator.FriendCount, &data.Creator.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	data.Creator.ImageURL = postUserImage.String
+	if err := json.Unmarshal(tagsJSON, &data.PostContent.Tags); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal tags JSON")
+	}
+	data.Reactions, err = decodeReactionCounts(reactionsJSON)
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// visibleTo restricts a post query to what userId is allowed to read: their own
+// posts, public posts and friends-only posts of their friends, unless either of
+// them blocked the other.
+func visibleTo(q *helper.Query, userId int) {
+	q.Query(" AND (p.user_id = ")
+	q.Param(userId)
+	q.Query(" OR p.visibility = 'public' OR (p.visibility = 'friends' AND ")
+	isFriendOf(q, userId)
+	q.Query("))")
+	q.Query(` AND NOT EXISTS (
+		    SELECT 1 FROM user_blocks b
+		    WHERE (b.user_id = p.user_id AND b.target_id = `)
+	q.Param(userId)
+	q.Query(") OR (b.target_id = p.user_id AND b.user_id = ")
+	q.Param(userId)
+	q.Query(")\n\t\t)")
+}
+
+// notMutedBy drops posts whose author userId muted.
+func notMutedBy(q *helper.Query, userId int) {
+	q.Query(" AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.target_id = p.user_id AND m.user_id = ")
+	q.Param(userId)
+	q.Query(")")
+}
+
+// isFollowedBy matches posts whose author userId follows.
+func isFollowedBy(q *helper.Query, userId int) {
+	q.Query("EXISTS (SELECT 1 FROM follows f WHERE f.followee_id = p.user_id AND f.status = 'accepted' AND f.follower_id = ")
+	q.Param(userId)
+	q.Query(")")
+}
+
+// isFriendOf matches posts whose author is a friend of userId.
+func isFriendOf(q *helper.Query, userId int) {
+	q.Query(`EXISTS (
+		    SELECT 1 FROM relationships r
+		    WHERE (r.user_first_id = p.user_id AND r.user_second_id = `)
+	q.Param(userId)
+	q.Query(") OR (r.user_second_id = p.user_id AND r.user_first_id = ")
+	q.Param(userId)
+	q.Query(")\n\t\t)")
+}
+
+func (ps *PostStore) GetPost(ctx context.Context, postId int, userId int) (*model.PostResponseData, error) {
+	q := helper.Query{}
+	q.Query(postColumns)
+	q.Query(`
+		FROM posts p
+		LEFT JOIN users u ON p.user_id = u.id
+		WHERE p.deleted_at IS NULL AND p.id = `)
+	q.Param(postId)
+	visibleTo(&q, userId)
+	query, params := q.Get()
+	data, err := scanPost(ps.db.QueryRow(ctx, query, params...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPostNotFound
+		}
+		return nil, errors.Wrap(err, "failed to get post")
+	}
+	if err := ps.loadComments(ctx, []*model.PostResponseData{data}, userId); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (ps *PostStore) GetPostList(ctx context.Context, userId int, queryParams url.Values) (*model.PostResponse, error) {
+	return ps.listPosts(ctx, userId, queryParams, false)
+}
+
+// GetFeed lists the posts of userId, of their friends and the public posts of
+// the users they follow, leaving out the users userId muted.
+func (ps *PostStore) GetFeed(ctx context.Context, userId int, queryParams url.Values) (*model.PostResponse, error) {
+	return ps.listPosts(ctx, userId, queryParams, true)
+}
+
+func (ps *PostStore) listPosts(ctx context.Context, userId int, queryParams url.Values, feed bool) (*model.PostResponse, error) {
 	q := helper.Query{}
+	q.Query(postColumns)
 	q.Query(`
-		SELECT p.id, p.html, p.tags, p.created_at,
-		       u.id post_creator_id, u.name as post_creator_name, u.image_url, u.friend_count, u.created_at
 		FROM posts p
-		LEFT JOIN users u ON p.user_id  = u.id 
-		WHERE`)
+		LEFT JOIN users u ON p.user_id  = u.id `)
 	var err error
 
-	search := queryParams.Get("search")
-	tags := queryParams["searchTag"]
-	hasParams := false
-	if len(tags) > 0 || search != "" {
-		hasParams = true
+	search := parseSearch(queryParams.Get("search"))
+	sort, err := parseSort(queryParams.Get("sort"), search.terms)
+	if err != nil {
+		return nil, err
+	}
+	// The query is joined in, so that ranking can use it without another
+	// parameter after the WHERE clause.
+	if search.terms != "" {
+		q.Query("CROSS JOIN websearch_to_tsquery('english', ")
+		q.Param(search.terms)
+		q.Query(") tsq")
 	}
+	q.Query(`
+		WHERE p.deleted_at IS NULL`)
+
+	visibleTo(&q, userId)
+	if feed {
+		q.Query(" AND (p.user_id = ")
+		q.Param(userId)
+		q.Query(" OR ")
+		isFriendOf(&q, userId)
+		q.Query(" OR (p.visibility = 'public' AND ")
+		isFollowedBy(&q, userId)
+		q.Query("))")
+		notMutedBy(&q, userId)
+	}
+
+	tags := queryParams["searchTag"]
 
-	if search != "" {
-		q.Query(" AND p.html LIKE ")
-		q.Param("%" + search + "%")
+	if search.terms != "" {
+		q.Query(" AND p.search_vector @@ tsq")
+	}
+	if len(search.from) > 0 {
+		// Handles are never only digits, so an author matches either by id or
+		// by handle.
+		q.Query(" AND (p.user_id::text = ANY(")
+		q.Param(search.from)
+		q.Query(") OR LOWER(u.handle) = ANY(")
+		q.Param(search.from)
+		q.Query("))")
 	}
 
 	if len(tags) > 0 {
@@ -121,8 +416,12 @@ func (ps *PostStore) GetPostList(ctx context.Context, queryParams url.Values) (*
 		offset = offsetx
 	}
 
-	q.Query(fmt.Sprintf("\nORDER BY %s", "p.created_at"))
-	q.Query(fmt.Sprintf(" %s", "DESC"))
+	if sort == SortRelevance {
+		q.Query("\nORDER BY ts_rank_cd(p.search_vector, tsq) DESC, p.created_at DESC")
+	} else {
+		q.Query(fmt.Sprintf("\nORDER BY %s", "p.created_at"))
+		q.Query(fmt.Sprintf(" %s", "DESC"))
+	}
 
 	q.Query(" LIMIT ")
 	q.Param(limit)
@@ -130,92 +429,41 @@ func (ps *PostStore) GetPostList(ctx context.Context, queryParams url.Values) (*
 	q.Param(offset)
 
 	query, params := q.Get()
-	if !hasParams {
-		query = strings.Replace(query, "WHERE", "", 1)
-	} else {
-		if strings.Count(query, "AND") == 0 {
-			query = strings.Replace(query, "WHERE", "", 1)
-		}
-		query = strings.Replace(query, "WHERE AND", "WHERE", 1)
-	}
 
 	rows, err := ps.db.Query(ctx, query, params...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get posts")
 	}
+	defer rows.Close()
 	order := make([]*model.PostResponseData, 0)
-	orderID := make([]string, 0)
 	for rows.Next() {
-		var data model.PostResponseData
-		var tagsJSON []byte
-		var postUserImage sql.NullString
-		err := rows.Scan(&data.PostID, &data.PostContent.PostInHTML, &tagsJSON, &data.PostContent.CreatedAt, &data.Creator.UserId, &data.Creator.Name, &postUserImage, &data.Creator.FriendCount, &data.Creator.CreatedAt)
-		order = append(order, &data)
-		orderID = append(orderID, data.PostID)
+		data, err := scanPost(rows)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to scan posts")
 		}
-		if err := json.Unmarshal(tagsJSON, &data.PostContent.Tags); err != nil {
-			return nil, errors.Wrap(err, "failed to unmarshal tags JSON")
-		}
+		order = append(order, data)
 	}
-	var res model.PostResponse = model.PostResponse{
-		Data: []model.PostResponseData{},
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
 	}
 
-	query2 := fmt.Sprintf(`
-		SELECT c.id, c.comment, c.post_id, c.user_id,  c.created_at,
-		u.id, u.name, u.image_url, u.friend_count, u.created_at
-		FROM comments c
-		LEFT JOIN users u ON c.user_id = u.id
-		WHERE c.post_id IN (%s)
-	`, strings.Join(orderID, ","))
-	rows, err = ps.db.Query(ctx, query2)
-	var comments = make(map[int][]*model.CommentAndUser, 0)
-	for rows.Next() {
-		var mod model.CommentAndUser
-		err = rows.Scan(&mod.Comment.Id, &mod.Comment.Comment, &mod.Comment.PostId, &mod.Comment.UserId, &mod.Comment.CreatedAt, &mod.Creator.UserId, &mod.Creator.Name, &mod.Creator.ImageURL, &mod.Creator.FriendCount, &mod.Creator.CreatedAt)
-
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to scan comments")
-		}
+	if err := ps.loadComments(ctx, order, userId); err != nil {
+		return nil, err
+	}
+	if err := ps.loadHighlights(ctx, order, search.terms); err != nil {
+		return nil, err
+	}
 
-		comments[mod.Comment.PostId] = append(comments[mod.Comment.PostId], &mod)
+	var res model.PostResponse = model.PostResponse{
+		Data: []model.PostResponseData{},
 	}
 	for _, ord := range order {
-		id, err := strconv.Atoi(ord.PostID)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to convert")
-		}
-		ord.Comments = make([]model.CommentResponseValid, 0)
-		current, ok := comments[id]
-		if ok {
-			for _, el := range current {
-				ord.Comments = append(ord.Comments, model.CommentResponseValid{
-					Comment: el.Comment.Comment,
-					Creator: model.CreatorValid{
-						UserId:      el.Creator.UserId,
-						Name:        el.Creator.Name,
-						ImageURL:    el.Creator.ImageURL,
-						FriendCount: el.Creator.FriendCount,
-						CreatedAt:   el.Creator.CreatedAt,
-					},
-				})
-
-			}
-
-		}
 		res.Data = append(res.Data, *ord)
 	}
 
-	countQuery := strings.Split(strings.Split(query, q.Arr[0])[1], "ORDER")[0]
+	countQuery := strings.Split(strings.TrimPrefix(query, q.Arr[0]), "ORDER")[0]
+	countQuery = fmt.Sprintf("SELECT COUNT(*) %s", countQuery)
 	params = params[:len(params)-2]
-	if len(params) > 0 {
-		countQuery = fmt.Sprintf("SELECT COUNT(*) FROM posts p WHERE %s", countQuery)
-	} else {
-		countQuery = fmt.Sprintf("SELECT COUNT(*) FROM posts p %s", countQuery)
-
-	}
 
 	var count int
 	err = ps.db.QueryRow(ctx, countQuery, params...).Scan(&count)
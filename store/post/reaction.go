@@ -0,0 +1,225 @@
+package post
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/billymosis/socialmedia-app/helper"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/store/notification"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+var ErrCommentNotFound = errors.New("comment not found")
+
+type reactionTarget struct {
+	table         string
+	reactionTable string
+	column        string
+	notFound      error
+	notification  string
+}
+
+var (
+	postReaction    = reactionTarget{"posts", "post_reactions", "post_id", ErrPostNotFound, model.NotificationReaction}
+	commentReaction = reactionTarget{"comments", "comment_reactions", "comment_id", ErrCommentNotFound, model.NotificationCommentReact}
+)
+
+// lockPost locks a post the user is allowed to see so that its counters can be
+// updated.
+func lockPost(ctx context.Context, tx pgx.Tx, postId int, userId int) error {
+	q := helper.Query{}
+	q.Query("SELECT p.id FROM posts p WHERE p.deleted_at IS NULL AND p.id = ")
+	q.Param(postId)
+	visibleTo(&q, userId)
+	q.Query(" FOR UPDATE OF p")
+	query, params := q.Get()
+	var id int
+	err := tx.QueryRow(ctx, query, params...).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrPostNotFound
+	}
+	return err
+}
+
+// lockComment locks a comment whose post the user is allowed to see.
+func lockComment(ctx context.Context, tx pgx.Tx, commentId int, userId int) error {
+	q := helper.Query{}
+	q.Query(`
+		SELECT c.id FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		WHERE p.deleted_at IS NULL AND c.deleted_at IS NULL AND c.id = `)
+	q.Param(commentId)
+	visibleTo(&q, userId)
+	q.Query(" FOR UPDATE OF c")
+	query, params := q.Get()
+	var id int
+	err := tx.QueryRow(ctx, query, params...).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrCommentNotFound
+	}
+	return err
+}
+
+func (ps *PostStore) SetPostReaction(ctx context.Context, postId int, userId int, kind string) (*model.ReactionSummary, error) {
+	return ps.setReaction(ctx, postReaction, lockPost, postId, userId, &kind)
+}
+
+func (ps *PostStore) DeletePostReaction(ctx context.Context, postId int, userId int) (*model.ReactionSummary, error) {
+	return ps.setReaction(ctx, postReaction, lockPost, postId, userId, nil)
+}
+
+func (ps *PostStore) SetCommentReaction(ctx context.Context, commentId int, userId int, kind string) (*model.ReactionSummary, error) {
+	return ps.setReaction(ctx, commentReaction, lockComment, commentId, userId, &kind)
+}
+
+func (ps *PostStore) DeleteCommentReaction(ctx context.Context, commentId int, userId int) (*model.ReactionSummary, error) {
+	return ps.setReaction(ctx, commentReaction, lockComment, commentId, userId, nil)
+}
+
+// setReaction replaces the reaction of userId on a target with kind, or removes
+// it when kind is nil, keeping the denormalized counters in the same
+// transaction.
+func (ps *PostStore) setReaction(ctx context.Context, target reactionTarget, lock func(context.Context, pgx.Tx, int, int) error, targetId int, userId int, kind *string) (*model.ReactionSummary, error) {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lock(ctx, tx, targetId, userId); err != nil {
+		if errors.Is(err, target.notFound) {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "failed to lock reaction target")
+	}
+
+	var current *string
+	var notified []model.NotificationEvent
+	query := fmt.Sprintf("SELECT kind FROM %s WHERE %s = $1 AND user_id = $2", target.reactionTable, target.column)
+	err = tx.QueryRow(ctx, query, targetId, userId).Scan(&current)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.Wrap(err, "failed to get reaction")
+	}
+
+	sameKind := current != nil && kind != nil && *current == *kind
+	if !sameKind {
+		if current != nil {
+			query = fmt.Sprintf("DELETE FROM %s WHERE %s = $1 AND user_id = $2", target.reactionTable, target.column)
+			if _, err := tx.Exec(ctx, query, targetId, userId); err != nil {
+				return nil, errors.Wrap(err, "failed to delete reaction")
+			}
+			if err := incrementReaction(ctx, tx, target, targetId, *current, -1); err != nil {
+				return nil, err
+			}
+		}
+		if kind != nil {
+			query = fmt.Sprintf("INSERT INTO %s (%s, user_id, kind) VALUES ($1, $2, $3)", target.reactionTable, target.column)
+			if _, err := tx.Exec(ctx, query, targetId, userId, *kind); err != nil {
+				return nil, errors.Wrap(err, "failed to create reaction")
+			}
+			if err := incrementReaction(ctx, tx, target, targetId, *kind, 1); err != nil {
+				return nil, err
+			}
+			event, err := notifyReaction(ctx, tx, target, targetId, userId)
+			if err != nil {
+				return nil, err
+			}
+			notified = append(notified, event)
+		}
+	}
+
+	var countsJSON []byte
+	query = fmt.Sprintf("SELECT reaction_counts FROM %s WHERE id = $1", target.table)
+	if err := tx.QueryRow(ctx, query, targetId).Scan(&countsJSON); err != nil {
+		return nil, errors.Wrap(err, "failed to get reaction counts")
+	}
+	counts, err := decodeReactionCounts(countsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to commit reaction")
+	}
+	ps.events.Notify(notified...)
+	return &model.ReactionSummary{
+		Counts: counts,
+		Mine:   kind,
+	}, nil
+}
+
+func incrementReaction(ctx context.Context, tx pgx.Tx, target reactionTarget, targetId int, kind string, delta int) error {
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET reaction_counts = jsonb_set(
+		    reaction_counts,
+		    ARRAY[$1::text],
+		    to_jsonb(GREATEST(COALESCE((reaction_counts->>$1::text)::int, 0) + $2, 0))
+		)
+		WHERE id = $3
+	`, target.table)
+	_, err := tx.Exec(ctx, query, kind, delta, targetId)
+	if err != nil {
+		return errors.Wrap(err, "failed to update reaction counts")
+	}
+	return nil
+}
+
+func notifyReaction(ctx context.Context, tx pgx.Tx, target reactionTarget, targetId int, userId int) (model.NotificationEvent, error) {
+	event := model.NotificationEvent{
+		ActorId:  userId,
+		Type:     target.notification,
+		TargetId: targetId,
+	}
+	query := fmt.Sprintf("SELECT user_id FROM %s WHERE id = $1", target.table)
+	if err := tx.QueryRow(ctx, query, targetId).Scan(&event.UserId); err != nil {
+		return event, errors.Wrap(err, "failed to get reaction target owner")
+	}
+	return event, notification.Push(ctx, tx, event)
+}
+
+// decodeReactionCounts turns the stored counters into a response map without
+// the kinds that dropped back to zero.
+func decodeReactionCounts(countsJSON []byte) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(countsJSON) > 0 {
+		if err := json.Unmarshal(countsJSON, &counts); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal reaction counts")
+		}
+	}
+	for k, v := range counts {
+		if v <= 0 {
+			delete(counts, k)
+		}
+	}
+	return counts, nil
+}
+
+// myReactions returns the reaction userId left on each of targetIds.
+func (ps *PostStore) myReactions(ctx context.Context, target reactionTarget, targetIds []int, userId int) (map[int]string, error) {
+	mine := make(map[int]string)
+	if len(targetIds) == 0 {
+		return mine, nil
+	}
+	query := fmt.Sprintf("SELECT %s, kind FROM %s WHERE user_id = $1 AND %s = ANY($2)", target.column, target.reactionTable, target.column)
+	rows, err := ps.db.Query(ctx, query, userId, targetIds)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get reactions")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var kind string
+		if err := rows.Scan(&id, &kind); err != nil {
+			return nil, errors.Wrap(err, "failed to scan reaction")
+		}
+		mine[id] = kind
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	return mine, nil
+}
@@ -0,0 +1,108 @@
+package post
+
+import (
+	"context"
+
+	"github.com/billymosis/socialmedia-app/service/markup"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// resanitizeTargets are the tables whose user content is sanitized, with the
+// column holding it and, for posts, the column holding its text for search.
+var resanitizeTargets = []struct {
+	table      string
+	column     string
+	textColumn string
+}{
+	{"posts", "html", "search_text"},
+	{"comments", "comment", ""},
+}
+
+// Resanitize runs the current sanitizer over every post and comment, batchSize
+// rows at a time, and rewrites the ones it changes. It returns how many rows
+// were rewritten per table. It is meant to be run after the sanitizer policy
+// changes, and for content stored before there was one. The search text of
+// posts is brought up to date along the way.
+func (ps *PostStore) Resanitize(ctx context.Context, batchSize int) (map[string]int, error) {
+	changed := make(map[string]int)
+	for _, target := range resanitizeTargets {
+		lastId := 0
+		for {
+			n, next, err := ps.resanitizeBatch(ctx, target.table, target.column, target.textColumn, lastId, batchSize)
+			if err != nil {
+				return changed, err
+			}
+			changed[target.table] += n
+			if next == lastId {
+				break
+			}
+			lastId = next
+		}
+	}
+	return changed, nil
+}
+
+// resanitizeBatch sanitizes the batchSize rows after lastId and returns how many
+// of them changed and the id to continue after. textColumn, when set, is
+// rewritten with the text of the sanitized content.
+func (ps *PostStore) resanitizeBatch(ctx context.Context, table string, column string, textColumn string, lastId int, batchSize int) (int, int, error) {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return 0, lastId, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	text := "''"
+	if textColumn != "" {
+		text = textColumn
+	}
+	query := "SELECT id, " + column + ", " + text + " FROM " + table + " WHERE id > $1 ORDER BY id LIMIT $2 FOR UPDATE"
+	rows, err := tx.Query(ctx, query, lastId, batchSize)
+	if err != nil {
+		return 0, lastId, errors.Wrap(err, "failed to get "+table)
+	}
+	type row struct {
+		id      int
+		content string
+		text    string
+	}
+	batch, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (row, error) {
+		var item row
+		err := r.Scan(&item.id, &item.content, &item.text)
+		return item, err
+	})
+	if err != nil {
+		return 0, lastId, errors.Wrap(err, "failed to scan "+table)
+	}
+
+	changed := 0
+	next := lastId
+	for _, item := range batch {
+		next = item.id
+		clean := markup.Sanitize(item.content)
+		if clean != item.content {
+			query := "UPDATE " + table + " SET " + column + " = $1 WHERE id = $2"
+			if _, err := tx.Exec(ctx, query, clean, item.id); err != nil {
+				return 0, lastId, errors.Wrap(err, "failed to update "+table)
+			}
+		}
+		if textColumn != "" {
+			if cleanText := markup.Text(clean); cleanText != item.text {
+				query := "UPDATE " + table + " SET " + textColumn + " = $1 WHERE id = $2"
+				if _, err := tx.Exec(ctx, query, cleanText, item.id); err != nil {
+					return 0, lastId, errors.Wrap(err, "failed to update "+table)
+				}
+			}
+		}
+		if clean == item.content {
+			continue
+		}
+		changed++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, lastId, errors.Wrap(err, "failed to commit "+table)
+	}
+	return changed, next, nil
+}
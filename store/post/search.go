@@ -0,0 +1,115 @@
+package post
+
+import (
+	"context"
+	"html"
+	"strings"
+
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	SortRelevance = "relevance"
+	SortRecent    = "recent"
+)
+
+var ErrInvalidSort = errors.New("sort must be relevance or recent")
+
+// searchQuery is the search parameter of a post list split into the words to
+// look for and the authors given with from:handle or from:id.
+type searchQuery struct {
+	terms string
+	from  []string
+}
+
+// parseSearch splits search into its terms, which are left for
+// websearch_to_tsquery to parse, and its from: filters.
+func parseSearch(search string) searchQuery {
+	var sq searchQuery
+	var terms []string
+	for _, word := range strings.Fields(search) {
+		if len(word) > len("from:") && strings.EqualFold(word[:len("from:")], "from:") {
+			author := strings.TrimPrefix(word[len("from:"):], "@")
+			if author != "" {
+				sq.from = append(sq.from, strings.ToLower(author))
+			}
+			continue
+		}
+		terms = append(terms, word)
+	}
+	sq.terms = strings.Join(terms, " ")
+	return sq
+}
+
+// parseSort returns how a post list is ordered. Relevance is the default when
+// there is something to rank by, and without search terms there is not, so
+// posts come newest first then.
+func parseSort(sort string, terms string) (string, error) {
+	switch sort {
+	case "":
+		if terms != "" {
+			return SortRelevance, nil
+		}
+		return SortRecent, nil
+	case SortRelevance:
+		if terms == "" {
+			return SortRecent, nil
+		}
+		return SortRelevance, nil
+	case SortRecent:
+		return SortRecent, nil
+	}
+	return "", ErrInvalidSort
+}
+
+// The headline marks matches with control characters, which markup.Text never
+// leaves in search_text, so that the snippet can be escaped before the marks
+// become HTML.
+const (
+	highlightStart = "\x01"
+	highlightStop  = "\x02"
+)
+
+// loadHighlights sets the highlight of every post to the parts of its text
+// that match terms, with the matches in <mark> elements.
+func (ps *PostStore) loadHighlights(ctx context.Context, posts []*model.PostResponseData, terms string) error {
+	if len(posts) == 0 || terms == "" {
+		return nil
+	}
+	byId := make(map[string]*model.PostResponseData, len(posts))
+	ids := make([]string, 0, len(posts))
+	for _, post := range posts {
+		byId[post.PostID] = post
+		ids = append(ids, post.PostID)
+	}
+
+	query := `
+		SELECT p.id::text, ts_headline('english', p.search_text, websearch_to_tsquery('english', $2),
+		       'StartSel=` + highlightStart + `, StopSel=` + highlightStop + `, MaxFragments=2, MaxWords=20, MinWords=5')
+		FROM posts p
+		WHERE p.id = ANY($1::int[])
+	`
+	rows, err := ps.db.Query(ctx, query, ids, terms)
+	if err != nil {
+		return errors.Wrap(err, "failed to get highlights")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, headline string
+		if err := rows.Scan(&id, &headline); err != nil {
+			return errors.Wrap(err, "failed to scan highlight")
+		}
+		if !strings.Contains(headline, highlightStart) {
+			continue
+		}
+		highlight := html.EscapeString(headline)
+		highlight = strings.ReplaceAll(highlight, highlightStart, "<mark>")
+		highlight = strings.ReplaceAll(highlight, highlightStop, "</mark>")
+		byId[id].Highlight = &highlight
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "error while iterating over rows")
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Package relation tells how the signed in user relates to the users shown to
+// them. It works on whole responses at once, so that a list costs one query
+// however many users it holds.
+package relation
+
+import (
+	"context"
+
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// Querier is satisfied by both a pool and a transaction.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Load returns the relation of viewerId to every user in userIds. A user is
+// blocked when viewerId blocked them; being blocked by them is not revealed.
+func Load(ctx context.Context, db Querier, viewerId int, userIds []int) (map[int]model.Relation, error) {
+	relations := make(map[int]model.Relation, len(userIds))
+	if len(userIds) == 0 {
+		return relations, nil
+	}
+	query := `
+		WITH targets AS (
+		    SELECT DISTINCT UNNEST($2::int[]) AS id
+		), viewer_friends AS (
+		    SELECT CASE WHEN user_first_id = $1 THEN user_second_id ELSE user_first_id END AS friend_id
+		    FROM relationships
+		    WHERE user_first_id = $1 OR user_second_id = $1
+		)
+		SELECT t.id,
+		       CASE
+		           WHEN t.id = $1 THEN $3::text
+		           WHEN EXISTS (SELECT 1 FROM user_blocks b WHERE b.user_id = $1 AND b.target_id = t.id) THEN $4
+		           WHEN EXISTS (SELECT 1 FROM viewer_friends WHERE friend_id = t.id) THEN $5
+		           WHEN EXISTS (
+		               SELECT 1 FROM friend_requests fr
+		               WHERE fr.status = 'pending' AND fr.sender_id = $1 AND fr.receiver_id = t.id
+		           ) THEN $6
+		           WHEN EXISTS (
+		               SELECT 1 FROM friend_requests fr
+		               WHERE fr.status = 'pending' AND fr.sender_id = t.id AND fr.receiver_id = $1
+		           ) THEN $7
+		           ELSE $8
+		       END,
+		       CASE WHEN t.id = $1 THEN 0 ELSE (
+		           SELECT COUNT(*) FROM relationships r
+		           JOIN viewer_friends vf ON vf.friend_id = CASE WHEN r.user_first_id = t.id THEN r.user_second_id ELSE r.user_first_id END
+		           WHERE r.user_first_id = t.id OR r.user_second_id = t.id
+		       ) END
+		FROM targets t
+	`
+	rows, err := db.Query(ctx, query, viewerId, userIds,
+		model.RelationshipSelf, model.RelationshipBlocked, model.RelationshipFriend,
+		model.RelationshipPendingOutgoing, model.RelationshipPendingIncoming, model.RelationshipNone)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get relations")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var relation model.Relation
+		if err := rows.Scan(&id, &relation.Relationship, &relation.MutualCount); err != nil {
+			return nil, errors.Wrap(err, "failed to scan relation")
+		}
+		relations[id] = relation
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	return relations, nil
+}
+
+// Annotate sets the relation of viewerId to each of users.
+func Annotate(ctx context.Context, db Querier, viewerId int, users []*model.CreatorValid) error {
+	userIds := make([]int, 0, len(users))
+	for _, user := range users {
+		userIds = append(userIds, user.UserId)
+	}
+	relations, err := Load(ctx, db, viewerId, userIds)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		user.Relation = relations[user.UserId]
+	}
+	return nil
+}
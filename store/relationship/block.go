@@ -0,0 +1,260 @@
+package relationship
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/helper"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/realtime"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSelfRestrict = errors.New("cannot block or mute yourself")
+	ErrBlocked      = errors.New("user is blocked")
+)
+
+// Blocks and mutes are stored the same way, one row per user and target, in
+// these tables.
+const (
+	blockTable = "user_blocks"
+	muteTable  = "user_mutes"
+)
+
+type Restriction struct {
+	CreatedAt time.Time
+	User      Friend
+}
+
+type GetRestrictionListRow struct {
+	Users []*Restriction
+	Meta  Meta
+}
+
+// notBlocked drops rows whose user, in column, blocked userId or was blocked by
+// them.
+func notBlocked(q *helper.Query, column string, userId int) {
+	q.Query(` AND NOT EXISTS (
+		    SELECT 1 FROM user_blocks b
+		    WHERE (b.user_id = ` + column + ` AND b.target_id = `)
+	q.Param(userId)
+	q.Query(") OR (b.target_id = " + column + " AND b.user_id = ")
+	q.Param(userId)
+	q.Query(")\n\t\t)")
+}
+
+// IsBlocked reports whether either user blocked the other.
+func (ps *RelationshipStore) IsBlocked(ctx context.Context, otherId int, userId int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+		    SELECT 1
+		    FROM user_blocks
+		    WHERE (user_id = $1 AND target_id = $2)
+		    OR (user_id = $2 AND target_id = $1)
+		)
+	`
+	var blocked bool
+	if err := ps.db.QueryRow(ctx, query, userId, otherId).Scan(&blocked); err != nil {
+		return false, errors.Wrap(err, "failed check block exist")
+	}
+	return blocked, nil
+}
+
+// restrict adds targetId to the blocks or mutes of userId. Doing it twice is not
+// an error.
+func restrict(ctx context.Context, tx pgx.Tx, table string, targetId int, userId int) error {
+	if targetId == userId {
+		return ErrSelfRestrict
+	}
+
+	var exist bool
+	err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", targetId).Scan(&exist)
+	if err != nil {
+		return errors.Wrap(err, "failed check user exist")
+	}
+	if !exist {
+		return ErrNotExist
+	}
+
+	query := "INSERT INTO " + table + " (user_id, target_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	if _, err := tx.Exec(ctx, query, userId, targetId); err != nil {
+		return errors.Wrap(err, "failed to add "+table)
+	}
+	return nil
+}
+
+// Block stops targetId and userId from interacting. Their friendship ends like
+// with DeleteFriend, pending friend requests between them are cancelled and
+// neither follows the other anymore. Direct messages need a friendship, so they
+// stop as well. Groups the two share are left alone, but neither can be invited
+// to a group the other is in.
+func (ps *RelationshipStore) Block(ctx context.Context, targetId int, userId int) error {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := restrict(ctx, tx, blockTable, targetId, userId); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, deleteFriendQuery, userId, targetId)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete relation")
+	}
+
+	query := `
+		UPDATE friend_requests SET status = $3, responded_at = CURRENT_TIMESTAMP
+		WHERE status = $4
+		AND ((sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1))
+	`
+	_, err = tx.Exec(ctx, query, userId, targetId, model.FriendRequestCancelled, model.FriendRequestPending)
+	if err != nil {
+		return errors.Wrap(err, "failed to cancel friend requests")
+	}
+	if err := deleteFollow(ctx, tx, userId, targetId); err != nil {
+		return err
+	}
+	if err := deleteFollow(ctx, tx, targetId, userId); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit block")
+	}
+	if tag.RowsAffected() > 0 {
+		ps.events.PublishFriendChange(realtime.EventFriendRemoved, userId, targetId)
+	}
+	return nil
+}
+
+// Mute hides the posts of targetId from the feed of userId. Nothing else
+// changes between them.
+func (ps *RelationshipStore) Mute(ctx context.Context, targetId int, userId int) error {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := restrict(ctx, tx, muteTable, targetId, userId); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit mute")
+	}
+	return nil
+}
+
+func (ps *RelationshipStore) Unblock(ctx context.Context, targetId int, userId int) error {
+	return ps.unrestrict(ctx, blockTable, targetId, userId)
+}
+
+func (ps *RelationshipStore) Unmute(ctx context.Context, targetId int, userId int) error {
+	return ps.unrestrict(ctx, muteTable, targetId, userId)
+}
+
+func (ps *RelationshipStore) unrestrict(ctx context.Context, table string, targetId int, userId int) error {
+	query := "DELETE FROM " + table + " WHERE user_id = $1 AND target_id = $2"
+	if _, err := ps.db.Exec(ctx, query, userId, targetId); err != nil {
+		return errors.Wrap(err, "failed to delete "+table)
+	}
+	return nil
+}
+
+func (ps *RelationshipStore) GetBlockList(ctx context.Context, userId int, queryParams url.Values) (*GetRestrictionListRow, error) {
+	return ps.listRestrictions(ctx, blockTable, userId, queryParams)
+}
+
+func (ps *RelationshipStore) GetMuteList(ctx context.Context, userId int, queryParams url.Values) (*GetRestrictionListRow, error) {
+	return ps.listRestrictions(ctx, muteTable, userId, queryParams)
+}
+
+func (ps *RelationshipStore) listRestrictions(ctx context.Context, table string, userId int, queryParams url.Values) (*GetRestrictionListRow, error) {
+	limit := 10
+	limitStr := queryParams.Get("limit")
+	if queryParams.Has("limit") && limitStr == "" {
+		return nil, errors.New("bad request")
+	}
+	if limitStr != "" {
+		limitx, err := strconv.Atoi(limitStr)
+		if err != nil || limitx < 0 {
+			return nil, errors.New("bad request")
+		}
+		limit = limitx
+	}
+
+	offset := 0
+	offsetStr := queryParams.Get("offset")
+	if queryParams.Has("offset") && offsetStr == "" {
+		return nil, errors.New("bad request")
+	}
+	if offsetStr != "" {
+		offsetx, err := strconv.Atoi(offsetStr)
+		if err != nil || offsetx < 0 {
+			return nil, errors.New("bad request")
+		}
+		offset = offsetx
+	}
+
+	query := `
+		SELECT t.created_at, u.id, u.name, u.image_url, u.friend_count, u.created_at
+		FROM ` + table + ` t
+		JOIN users u ON u.id = t.target_id
+		WHERE t.user_id = $1
+		ORDER BY t.created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := ps.db.Query(ctx, query, userId, limit, offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query "+table)
+	}
+	defer rows.Close()
+
+	users := make([]*Restriction, 0)
+	for rows.Next() {
+		var restriction Restriction
+		err := rows.Scan(
+			&restriction.CreatedAt,
+			&restriction.User.UserId,
+			&restriction.User.Name,
+			&restriction.User.ImageUrl,
+			&restriction.User.FriendCount,
+			&restriction.User.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan "+table)
+		}
+		users = append(users, &restriction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	friends := make([]*Friend, 0, len(users))
+	for _, restriction := range users {
+		friends = append(friends, &restriction.User)
+	}
+	if err := ps.annotateFriends(ctx, userId, friends); err != nil {
+		return nil, err
+	}
+
+	var count int
+	err = ps.db.QueryRow(ctx, "SELECT COUNT(*) FROM "+table+" WHERE user_id = $1", userId).Scan(&count)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get total "+table)
+	}
+
+	return &GetRestrictionListRow{
+		Users: users,
+		Meta: Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  count,
+		},
+	}, nil
+}
@@ -0,0 +1,358 @@
+package relationship
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/store/notification"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSelfFollow            = errors.New("cannot follow yourself")
+	ErrFollowRequestNotFound = errors.New("follow request not found")
+)
+
+type Follow struct {
+	Status    string
+	CreatedAt time.Time
+	User      Friend
+}
+
+type GetFollowListRow struct {
+	Follows []*Follow
+	Meta    Meta
+}
+
+// countFollow changes the follower count of followeeId and the following count
+// of followerId by delta. Only accepted follows are counted.
+func countFollow(ctx context.Context, tx pgx.Tx, followerId int, followeeId int, delta int) error {
+	query := `
+		UPDATE users
+		SET follower_count = follower_count + CASE WHEN id = $2 THEN $3 ELSE 0 END,
+		    following_count = following_count + CASE WHEN id = $1 THEN $3 ELSE 0 END
+		WHERE id IN ($1, $2)
+	`
+	if _, err := tx.Exec(ctx, query, followerId, followeeId, delta); err != nil {
+		return errors.Wrap(err, "failed to update follow counts")
+	}
+	return nil
+}
+
+// Follow makes userId follow targetId and returns the status of the follow. It
+// stays pending until targetId accepts it when they approve their followers.
+// Following twice is not an error.
+func (ps *RelationshipStore) Follow(ctx context.Context, targetId int, userId int) (string, error) {
+	if targetId == userId {
+		return "", ErrSelfFollow
+	}
+
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	var needApproval bool
+	err = tx.QueryRow(ctx, "SELECT followers_need_approval FROM users WHERE id = $1", targetId).Scan(&needApproval)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNotExist
+		}
+		return "", errors.Wrap(err, "failed check user exist")
+	}
+
+	var blocked bool
+	query := `
+		SELECT EXISTS (
+		    SELECT 1 FROM user_blocks
+		    WHERE (user_id = $1 AND target_id = $2) OR (user_id = $2 AND target_id = $1)
+		)
+	`
+	if err := tx.QueryRow(ctx, query, userId, targetId).Scan(&blocked); err != nil {
+		return "", errors.Wrap(err, "failed check block exist")
+	}
+	if blocked {
+		return "", ErrBlocked
+	}
+
+	status := model.FollowAccepted
+	if needApproval {
+		status = model.FollowPending
+	}
+	query = `
+		INSERT INTO follows (follower_id, followee_id, status, accepted_at)
+		VALUES ($1, $2, $3, CASE WHEN $3 = 'accepted' THEN CURRENT_TIMESTAMP END)
+		ON CONFLICT DO NOTHING
+	`
+	tag, err := tx.Exec(ctx, query, userId, targetId, status)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to follow")
+	}
+	if tag.RowsAffected() == 0 {
+		query = "SELECT status FROM follows WHERE follower_id = $1 AND followee_id = $2"
+		if err := tx.QueryRow(ctx, query, userId, targetId).Scan(&status); err != nil {
+			return "", errors.Wrap(err, "failed to get follow")
+		}
+		return status, nil
+	}
+
+	event := model.NotificationEvent{
+		UserId:  targetId,
+		ActorId: userId,
+		Type:    model.NotificationFollowRequest,
+	}
+	if status == model.FollowAccepted {
+		event.Type = model.NotificationFollow
+		if err := countFollow(ctx, tx, userId, targetId, 1); err != nil {
+			return "", err
+		}
+	}
+	if err := notification.Push(ctx, tx, event); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", errors.Wrap(err, "failed to commit follow")
+	}
+	ps.events.Notify(event)
+	return status, nil
+}
+
+// deleteFollow ends the follow of followeeId by followerId, or withdraws it
+// while it is pending.
+func deleteFollow(ctx context.Context, tx pgx.Tx, followerId int, followeeId int) error {
+	var status string
+	query := "DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2 RETURNING status"
+	err := tx.QueryRow(ctx, query, followerId, followeeId).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to delete follow")
+	}
+	if status == model.FollowAccepted {
+		return countFollow(ctx, tx, followerId, followeeId, -1)
+	}
+	return nil
+}
+
+// Unfollow stops userId from following targetId, or withdraws their pending
+// request.
+func (ps *RelationshipStore) Unfollow(ctx context.Context, targetId int, userId int) error {
+	return ps.changeFollow(ctx, userId, targetId, deleteFollow)
+}
+
+// RemoveFollower stops followerId from following userId, or turns down their
+// pending request.
+func (ps *RelationshipStore) RemoveFollower(ctx context.Context, followerId int, userId int) error {
+	return ps.changeFollow(ctx, followerId, userId, deleteFollow)
+}
+
+// AcceptFollower accepts the pending request of followerId to follow userId.
+func (ps *RelationshipStore) AcceptFollower(ctx context.Context, followerId int, userId int) error {
+	var event model.NotificationEvent
+	err := ps.changeFollow(ctx, followerId, userId, func(ctx context.Context, tx pgx.Tx, followerId int, followeeId int) error {
+		query := `
+			UPDATE follows SET status = $3, accepted_at = CURRENT_TIMESTAMP
+			WHERE follower_id = $1 AND followee_id = $2 AND status = $4
+		`
+		tag, err := tx.Exec(ctx, query, followerId, followeeId, model.FollowAccepted, model.FollowPending)
+		if err != nil {
+			return errors.Wrap(err, "failed to accept follow")
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrFollowRequestNotFound
+		}
+		if err := countFollow(ctx, tx, followerId, followeeId, 1); err != nil {
+			return err
+		}
+		event = model.NotificationEvent{
+			UserId:  followerId,
+			ActorId: followeeId,
+			Type:    model.NotificationFollowAccept,
+		}
+		return notification.Push(ctx, tx, event)
+	})
+	if err != nil {
+		return err
+	}
+	ps.events.Notify(event)
+	return nil
+}
+
+func (ps *RelationshipStore) changeFollow(ctx context.Context, followerId int, followeeId int, change func(ctx context.Context, tx pgx.Tx, followerId int, followeeId int) error) error {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := change(ctx, tx, followerId, followeeId); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit follow")
+	}
+	return nil
+}
+
+// AcceptPendingFollowers accepts every pending follow of userId. It is used when
+// userId stops approving their followers.
+func AcceptPendingFollowers(ctx context.Context, tx pgx.Tx, userId int) error {
+	query := `
+		UPDATE follows SET status = $2, accepted_at = CURRENT_TIMESTAMP
+		WHERE followee_id = $1 AND status = $3
+		RETURNING follower_id
+	`
+	rows, err := tx.Query(ctx, query, userId, model.FollowAccepted, model.FollowPending)
+	if err != nil {
+		return errors.Wrap(err, "failed to accept follows")
+	}
+	followerIds, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return errors.Wrap(err, "failed to scan follows")
+	}
+	if len(followerIds) == 0 {
+		return nil
+	}
+
+	query = `
+		UPDATE users
+		SET follower_count = follower_count + CASE WHEN id = $1 THEN $3 ELSE 0 END,
+		    following_count = following_count + CASE WHEN id = ANY($2) THEN 1 ELSE 0 END
+		WHERE id = $1 OR id = ANY($2)
+	`
+	if _, err := tx.Exec(ctx, query, userId, followerIds, len(followerIds)); err != nil {
+		return errors.Wrap(err, "failed to update follow counts")
+	}
+	return nil
+}
+
+// GetFollowerList pages through the users who follow ownerId, newest first.
+// Pending requests are listed with status=pending, to ownerId only.
+func (ps *RelationshipStore) GetFollowerList(ctx context.Context, ownerId int, userId int, queryParams url.Values) (*GetFollowListRow, error) {
+	return ps.listFollows(ctx, "f.followee_id", "f.follower_id", ownerId, userId, queryParams)
+}
+
+// GetFollowingList pages through the users ownerId follows, newest first.
+// Requests still pending are listed with status=pending, to ownerId only.
+func (ps *RelationshipStore) GetFollowingList(ctx context.Context, ownerId int, userId int, queryParams url.Values) (*GetFollowListRow, error) {
+	return ps.listFollows(ctx, "f.follower_id", "f.followee_id", ownerId, userId, queryParams)
+}
+
+func (ps *RelationshipStore) listFollows(ctx context.Context, ownColumn string, otherColumn string, ownerId int, userId int, queryParams url.Values) (*GetFollowListRow, error) {
+	status := model.FollowAccepted
+	switch queryParams.Get("status") {
+	case model.FollowAccepted, "":
+	case model.FollowPending:
+		if ownerId != userId {
+			return nil, errors.New("bad request: pending follows are private")
+		}
+		status = model.FollowPending
+	default:
+		return nil, errors.New("bad request: invalid status parameter")
+	}
+
+	limit := 10
+	limitStr := queryParams.Get("limit")
+	if queryParams.Has("limit") && limitStr == "" {
+		return nil, errors.New("bad request")
+	}
+	if limitStr != "" {
+		limitx, err := strconv.Atoi(limitStr)
+		if err != nil || limitx < 0 {
+			return nil, errors.New("bad request")
+		}
+		limit = limitx
+	}
+
+	offset := 0
+	offsetStr := queryParams.Get("offset")
+	if queryParams.Has("offset") && offsetStr == "" {
+		return nil, errors.New("bad request")
+	}
+	if offsetStr != "" {
+		offsetx, err := strconv.Atoi(offsetStr)
+		if err != nil || offsetx < 0 {
+			return nil, errors.New("bad request")
+		}
+		offset = offsetx
+	}
+
+	if ownerId != userId {
+		var exist bool
+		err := ps.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", ownerId).Scan(&exist)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed check user exist")
+		}
+		blocked, err := ps.IsBlocked(ctx, ownerId, userId)
+		if err != nil {
+			return nil, err
+		}
+		if !exist || blocked {
+			return nil, ErrNotExist
+		}
+	}
+
+	query := `
+		SELECT f.status, f.created_at, u.id, u.name, u.image_url, u.friend_count, u.created_at
+		FROM follows f
+		JOIN users u ON u.id = ` + otherColumn + `
+		WHERE ` + ownColumn + ` = $1 AND f.status = $2
+		ORDER BY f.created_at DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := ps.db.Query(ctx, query, ownerId, status, limit, offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query follows")
+	}
+	defer rows.Close()
+
+	follows := make([]*Follow, 0)
+	for rows.Next() {
+		var follow Follow
+		err := rows.Scan(
+			&follow.Status,
+			&follow.CreatedAt,
+			&follow.User.UserId,
+			&follow.User.Name,
+			&follow.User.ImageUrl,
+			&follow.User.FriendCount,
+			&follow.User.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan follow")
+		}
+		follows = append(follows, &follow)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	users := make([]*Friend, 0, len(follows))
+	for _, follow := range follows {
+		users = append(users, &follow.User)
+	}
+	if err := ps.annotateFriends(ctx, userId, users); err != nil {
+		return nil, err
+	}
+
+	var count int
+	countQuery := "SELECT COUNT(*) FROM follows f WHERE " + ownColumn + " = $1 AND f.status = $2"
+	if err := ps.db.QueryRow(ctx, countQuery, ownerId, status).Scan(&count); err != nil {
+		return nil, errors.Wrap(err, "failed to get total follows")
+	}
+
+	return &GetFollowListRow{
+		Follows: follows,
+		Meta: Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  count,
+		},
+	}, nil
+}
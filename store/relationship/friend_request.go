@@ -0,0 +1,350 @@
+package relationship
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/realtime"
+	"github.com/billymosis/socialmedia-app/store/notification"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+type FriendRequest struct {
+	Id        int
+	Status    string
+	CreatedAt time.Time
+	User      Friend
+}
+
+type GetFriendRequestListRow struct {
+	Requests []*FriendRequest
+	Meta     Meta
+}
+
+// SendFriendRequest creates a pending request from userId to receiverId. When
+// receiverId already asked userId to be friends the pending request is accepted
+// instead of creating a second one.
+func (ps *RelationshipStore) SendFriendRequest(ctx context.Context, receiverId int, userId int) (*model.FriendRequest, error) {
+	if receiverId == userId {
+		return nil, ErrSelfRequest
+	}
+
+	query := `
+		SELECT EXISTS (
+		    SELECT 1
+		    FROM users
+		    WHERE id = $1
+		)
+	`
+	var exist bool
+	err := ps.db.QueryRow(ctx, query, receiverId).Scan(&exist)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed check user exist")
+	}
+	if !exist {
+		return nil, ErrNotExist
+	}
+
+	blocked, err := ps.IsBlocked(ctx, receiverId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrBlocked
+	}
+
+	friend, err := ps.IsFriend(ctx, receiverId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if friend {
+		return nil, ErrAlreadyFriend
+	}
+
+	var incomingId int
+	query = `
+		SELECT id FROM friend_requests
+		WHERE sender_id = $1 AND receiver_id = $2 AND status = $3
+	`
+	err = ps.db.QueryRow(ctx, query, receiverId, userId, model.FriendRequestPending).Scan(&incomingId)
+	if err == nil {
+		return ps.AcceptFriendRequest(ctx, incomingId, userId)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.Wrap(err, "failed to check friend request")
+	}
+
+	request := model.FriendRequest{
+		SenderId:   userId,
+		ReceiverId: receiverId,
+		Status:     model.FriendRequestPending,
+	}
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	query = `
+		INSERT INTO friend_requests (sender_id, receiver_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+		RETURNING id, created_at
+	`
+	err = tx.QueryRow(ctx, query, userId, receiverId).Scan(&request.Id, &request.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRequestExist
+		}
+		return nil, errors.Wrap(err, "failed to create friend request")
+	}
+
+	event := model.NotificationEvent{
+		UserId:  receiverId,
+		ActorId: userId,
+		Type:    model.NotificationFriendRequest,
+	}
+	if err := notification.Push(ctx, tx, event); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to commit friend request")
+	}
+	ps.events.Notify(event)
+	return &request, nil
+}
+
+func (ps *RelationshipStore) IsFriend(ctx context.Context, userAddId int, userId int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+		    SELECT 1
+		    FROM relationships
+		    WHERE (user_first_id = $1 AND user_second_id = $2)
+		    OR (user_first_id = $2 AND user_second_id = $1)
+		)
+	`
+	var exist bool
+	err := ps.db.QueryRow(ctx, query, userId, userAddId).Scan(&exist)
+	if err != nil {
+		return false, errors.Wrap(err, "failed check relation exist")
+	}
+	return exist, nil
+}
+
+// respondFriendRequest locks a pending request and moves it to status. Only the
+// receiver may accept or reject, only the sender may cancel.
+func (ps *RelationshipStore) respondFriendRequest(ctx context.Context, tx pgx.Tx, requestId int, userId int, status string) (*model.FriendRequest, error) {
+	var request model.FriendRequest
+	query := `
+		SELECT id, sender_id, receiver_id, status, created_at
+		FROM friend_requests
+		WHERE id = $1
+		FOR UPDATE
+	`
+	err := tx.QueryRow(ctx, query, requestId).Scan(
+		&request.Id,
+		&request.SenderId,
+		&request.ReceiverId,
+		&request.Status,
+		&request.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRequestNotFound
+		}
+		return nil, errors.Wrap(err, "failed to get friend request")
+	}
+
+	owner := request.ReceiverId
+	if status == model.FriendRequestCancelled {
+		owner = request.SenderId
+	}
+	if owner != userId || request.Status != model.FriendRequestPending {
+		return nil, ErrRequestNotFound
+	}
+
+	query = `
+		UPDATE friend_requests SET status = $1, responded_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+		RETURNING status, responded_at
+	`
+	err = tx.QueryRow(ctx, query, status, requestId).Scan(&request.Status, &request.RespondedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to update friend request")
+	}
+	return &request, nil
+}
+
+func (ps *RelationshipStore) AcceptFriendRequest(ctx context.Context, requestId int, userId int) (*model.FriendRequest, error) {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	request, err := ps.respondFriendRequest(ctx, tx, requestId, userId, model.FriendRequestAccepted)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		WITH inserted_relationship AS (
+		  INSERT INTO relationships (user_first_id, user_second_id)
+		  VALUES ($1, $2)
+		  ON CONFLICT DO NOTHING
+		  RETURNING user_first_id, user_second_id
+		)
+		UPDATE users
+		SET friend_count = friend_count + 1
+		WHERE id IN (SELECT user_first_id FROM inserted_relationship UNION SELECT user_second_id FROM inserted_relationship);
+	`
+	_, err = tx.Exec(ctx, query, request.SenderId, request.ReceiverId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to add relation")
+	}
+
+	event := model.NotificationEvent{
+		UserId:  request.SenderId,
+		ActorId: request.ReceiverId,
+		Type:    model.NotificationFriendAccept,
+	}
+	if err := notification.Push(ctx, tx, event); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to commit friend request")
+	}
+	ps.events.PublishFriendChange(realtime.EventFriendAdded, request.SenderId, request.ReceiverId)
+	ps.events.Notify(event)
+	return request, nil
+}
+
+func (ps *RelationshipStore) RejectFriendRequest(ctx context.Context, requestId int, userId int) (*model.FriendRequest, error) {
+	return ps.closeFriendRequest(ctx, requestId, userId, model.FriendRequestRejected)
+}
+
+func (ps *RelationshipStore) CancelFriendRequest(ctx context.Context, requestId int, userId int) (*model.FriendRequest, error) {
+	return ps.closeFriendRequest(ctx, requestId, userId, model.FriendRequestCancelled)
+}
+
+func (ps *RelationshipStore) closeFriendRequest(ctx context.Context, requestId int, userId int, status string) (*model.FriendRequest, error) {
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	request, err := ps.respondFriendRequest(ctx, tx, requestId, userId, status)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to commit friend request")
+	}
+	return request, nil
+}
+
+func (ps *RelationshipStore) GetFriendRequestList(ctx context.Context, userId int, queryParams url.Values) (*GetFriendRequestListRow, error) {
+	var ownColumn, otherColumn string
+	switch queryParams.Get("direction") {
+	case "incoming", "":
+		ownColumn, otherColumn = "fr.receiver_id", "fr.sender_id"
+	case "outgoing":
+		ownColumn, otherColumn = "fr.sender_id", "fr.receiver_id"
+	default:
+		return nil, errors.New("bad request: invalid direction parameter")
+	}
+
+	limit := 10
+	limitStr := queryParams.Get("limit")
+	if queryParams.Has("limit") && limitStr == "" {
+		return nil, errors.New("bad request")
+	}
+	if limitStr != "" {
+		limitx, err := strconv.Atoi(limitStr)
+		if err != nil || limitx < 0 {
+			return nil, errors.New("bad request")
+		}
+		limit = limitx
+	}
+
+	offset := 0
+	offsetStr := queryParams.Get("offset")
+	if queryParams.Has("offset") && offsetStr == "" {
+		return nil, errors.New("bad request")
+	}
+	if offsetStr != "" {
+		offsetx, err := strconv.Atoi(offsetStr)
+		if err != nil || offsetx < 0 {
+			return nil, errors.New("bad request")
+		}
+		offset = offsetx
+	}
+
+	query := `
+		SELECT fr.id, fr.status, fr.created_at,
+		       u.id, u.name, u.image_url, u.friend_count, u.created_at
+		FROM friend_requests fr
+		JOIN users u ON u.id = ` + otherColumn + `
+		WHERE ` + ownColumn + ` = $1 AND fr.status = $2
+		ORDER BY fr.created_at DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := ps.db.Query(ctx, query, userId, model.FriendRequestPending, limit, offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query friend requests")
+	}
+	defer rows.Close()
+
+	requests := make([]*FriendRequest, 0)
+	for rows.Next() {
+		var request FriendRequest
+		err := rows.Scan(
+			&request.Id,
+			&request.Status,
+			&request.CreatedAt,
+			&request.User.UserId,
+			&request.User.Name,
+			&request.User.ImageUrl,
+			&request.User.FriendCount,
+			&request.User.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan friend request")
+		}
+		requests = append(requests, &request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	users := make([]*Friend, 0, len(requests))
+	for _, request := range requests {
+		users = append(users, &request.User)
+	}
+	if err := ps.annotateFriends(ctx, userId, users); err != nil {
+		return nil, err
+	}
+
+	var count int
+	countQuery := "SELECT COUNT(*) FROM friend_requests fr WHERE " + ownColumn + " = $1 AND fr.status = $2"
+	err = ps.db.QueryRow(ctx, countQuery, userId, model.FriendRequestPending).Scan(&count)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get total friend requests")
+	}
+
+	return &GetFriendRequestListRow{
+		Requests: requests,
+		Meta: Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  count,
+		},
+	}, nil
+}
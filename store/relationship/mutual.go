@@ -0,0 +1,131 @@
+package relationship
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/billymosis/socialmedia-app/store/relation"
+	"github.com/pkg/errors"
+)
+
+var ErrSelfMutual = errors.New("cannot list mutual friends with yourself")
+
+// annotateFriends sets how userId relates to each of friends.
+func (ps *RelationshipStore) annotateFriends(ctx context.Context, userId int, friends []*Friend) error {
+	ids := make([]int, 0, len(friends))
+	for _, friend := range friends {
+		id, err := strconv.Atoi(friend.UserId)
+		if err != nil {
+			return errors.Wrap(err, "failed to convert")
+		}
+		ids = append(ids, id)
+	}
+	relations, err := relation.Load(ctx, ps.db, userId, ids)
+	if err != nil {
+		return err
+	}
+	for i, friend := range friends {
+		friend.Relation = relations[ids[i]]
+	}
+	return nil
+}
+
+// GetMutualFriendList pages through the friends userId and otherId have in
+// common, by name. Users who blocked each other have no mutual friends to show.
+func (ps *RelationshipStore) GetMutualFriendList(ctx context.Context, otherId int, userId int, queryParams url.Values) (*GetFriendListRow, error) {
+	if otherId == userId {
+		return nil, ErrSelfMutual
+	}
+
+	limit := 10
+	limitStr := queryParams.Get("limit")
+	if queryParams.Has("limit") && limitStr == "" {
+		return nil, errors.New("bad request")
+	}
+	if limitStr != "" {
+		limitx, err := strconv.Atoi(limitStr)
+		if err != nil || limitx < 0 {
+			return nil, errors.New("bad request")
+		}
+		limit = limitx
+	}
+
+	offset := 0
+	offsetStr := queryParams.Get("offset")
+	if queryParams.Has("offset") && offsetStr == "" {
+		return nil, errors.New("bad request")
+	}
+	if offsetStr != "" {
+		offsetx, err := strconv.Atoi(offsetStr)
+		if err != nil || offsetx < 0 {
+			return nil, errors.New("bad request")
+		}
+		offset = offsetx
+	}
+
+	var exist bool
+	err := ps.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", otherId).Scan(&exist)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed check user exist")
+	}
+	blocked, err := ps.IsBlocked(ctx, otherId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !exist || blocked {
+		return nil, ErrNotExist
+	}
+
+	from := `
+		FROM users u
+		WHERE EXISTS (
+		    SELECT 1 FROM relationships r
+		    WHERE (r.user_first_id = $1 AND r.user_second_id = u.id) OR (r.user_second_id = $1 AND r.user_first_id = u.id)
+		)
+		AND EXISTS (
+		    SELECT 1 FROM relationships r
+		    WHERE (r.user_first_id = $2 AND r.user_second_id = u.id) OR (r.user_second_id = $2 AND r.user_first_id = u.id)
+		)
+	`
+	query := `
+		SELECT u.id, u.name, u.image_url, u.friend_count, u.created_at
+		` + from + `
+		ORDER BY u.name, u.id
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := ps.db.Query(ctx, query, userId, otherId, limit, offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query mutual friends")
+	}
+	defer rows.Close()
+
+	users := make([]*Friend, 0)
+	for rows.Next() {
+		var user Friend
+		if err := rows.Scan(&user.UserId, &user.Name, &user.ImageUrl, &user.FriendCount, &user.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan friend data")
+		}
+		users = append(users, &user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	if err := ps.annotateFriends(ctx, userId, users); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := ps.db.QueryRow(ctx, "SELECT COUNT(*) "+from, userId, otherId).Scan(&count); err != nil {
+		return nil, errors.Wrap(err, "failed to get total mutual friends")
+	}
+
+	return &GetFriendListRow{
+		Friends: users,
+		Meta: Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  count,
+		},
+	}, nil
+}
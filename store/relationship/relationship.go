@@ -9,74 +9,57 @@ import (
 	"time"
 
 	"github.com/billymosis/socialmedia-app/helper"
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/realtime"
 	"github.com/go-playground/validator/v10"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
 )
 
+var (
+	ErrNotExist        = errors.New("not exist")
+	ErrSelfRequest     = errors.New("cannot befriend yourself")
+	ErrAlreadyFriend   = errors.New("already friend")
+	ErrRequestExist    = errors.New("friend request already exist")
+	ErrRequestNotFound = errors.New("friend request not found")
+)
+
 type RelationshipStore struct {
 	db       *pgxpool.Pool
 	Validate *validator.Validate
+	events   *realtime.Hub
 }
 
-func NewRelationshipStore(db *pgxpool.Pool, validate *validator.Validate) *RelationshipStore {
+func NewRelationshipStore(db *pgxpool.Pool, validate *validator.Validate, events *realtime.Hub) *RelationshipStore {
 	return &RelationshipStore{
 		db:       db,
 		Validate: validate,
+		events:   events,
 	}
 }
 
-func (ps *RelationshipStore) AddFriend(ctx context.Context, userAddId int, userId int) error {
-
-	query := `
-		SELECT EXISTS (
-		    SELECT 1
-		    FROM users
-		    WHERE id = $1
-		)
-	`
-	var exist bool
-	err := ps.db.QueryRow(ctx, query, userId).Scan(&exist)
-	if err != nil {
-		return errors.Wrap(err, "failed check user exist")
-	}
-	if !exist {
-		return errors.New("not exist")
-	}
-	query = `
-		WITH inserted_relationship AS (
-		  INSERT INTO relationships (user_first_id, user_second_id)
-		  VALUES ($1, $2)
-		  RETURNING user_first_id, user_second_id
-		)
-		UPDATE users
-		SET friend_count = friend_count + 1
-		WHERE id IN (SELECT user_first_id FROM inserted_relationship UNION SELECT user_second_id FROM inserted_relationship);
-	`
-	_, err = ps.db.Exec(ctx, query, userId, userAddId)
-	if err != nil {
-		return errors.Wrap(err, "failed to add relation")
-	}
-	return nil
-}
-
-func (ps *RelationshipStore) DeleteFriend(ctx context.Context, userAddId int, userId int) error {
-	query := `
+const deleteFriendQuery = `
 	WITH deleted_relationship AS (
 		DELETE FROM relationships
 		WHERE
 		    (user_first_id = $1 AND user_second_id = $2)
 		    OR
 		    (user_first_id = $2 AND user_second_id = $1)
+		RETURNING user_first_id, user_second_id
 	)
 		UPDATE users
 		SET friend_count = friend_count - 1
-		WHERE users.id = $1 OR users.id = $2;
+		WHERE id IN (SELECT user_first_id FROM deleted_relationship UNION SELECT user_second_id FROM deleted_relationship);
 	`
-	_, err := ps.db.Exec(ctx, query, userId, userAddId)
+
+func (ps *RelationshipStore) DeleteFriend(ctx context.Context, userAddId int, userId int) error {
+	tag, err := ps.db.Exec(ctx, deleteFriendQuery, userId, userAddId)
 	if err != nil {
 		return errors.Wrap(err, "failed to add relation")
 	}
+	if tag.RowsAffected() > 0 {
+		ps.events.PublishFriendChange(realtime.EventFriendRemoved, userId, userAddId)
+	}
 	return nil
 }
 
@@ -91,6 +74,7 @@ type Friend struct {
 	ImageUrl    *string
 	FriendCount int
 	CreatedAt   time.Time
+	Relation    model.Relation
 }
 
 type GetFriendListRow struct {
@@ -119,19 +103,17 @@ func (ps *RelationshipStore) GetFriendList(ctx context.Context, userId int, quer
 		}
 	}
 	search := queryParams.Get("search")
-	hasParams := false
-	if onlyFriend || search != "" {
-		hasParams = true
-	}
 
 	if onlyFriend {
 		q.Query(" AND u.id <> ")
 		q.Param(userId)
-		q.Query(" AND r.user_first_id = ")
+		q.Query(" AND (r.user_first_id = ")
 		q.Param(userId)
 		q.Query(" OR r.user_second_id = ")
 		q.Param(userId)
+		q.Query(")")
 	}
+	notBlocked(&q, "u.id", userId)
 
 	limit := 10
 	limitStr := queryParams.Get("limit")
@@ -197,14 +179,7 @@ func (ps *RelationshipStore) GetFriendList(ctx context.Context, userId int, quer
 	q.Param(offset)
 	query, params := q.Get()
 
-	if !hasParams {
-		query = strings.Replace(query, "WHERE", "", 1)
-	} else {
-		if strings.Count(query, "AND") == 0 {
-			query = strings.Replace(query, "WHERE", "", 1)
-		}
-		query = strings.Replace(query, "WHERE AND", "WHERE", 1)
-	}
+	query = strings.Replace(query, "WHERE AND", "WHERE", 1)
 
 	rows, err := ps.db.Query(ctx, query, params...)
 	if err != nil {
@@ -225,6 +200,9 @@ func (ps *RelationshipStore) GetFriendList(ctx context.Context, userId int, quer
 	if err := rows.Err(); err != nil {
 		return nil, errors.Wrap(err, "error while iterating over rows")
 	}
+	if err := ps.annotateFriends(ctx, userId, users); err != nil {
+		return nil, err
+	}
 
 	countQuery := strings.Split(query, "LIMIT")[0]
 	countQuery = fmt.Sprintf(`
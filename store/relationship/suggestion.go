@@ -0,0 +1,299 @@
+package relationship
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Suggestions rank friends of friends by how many friends they share with the
+// user. Users who also used some of the same hashtags in their recent public
+// posts get a bonus, capped so that hashtags never outweigh many mutual
+// friends.
+const (
+	SuggestionsPerUser      = 50
+	SuggestionTagWeight     = 0.5
+	SuggestionMaxSharedTags = 4
+	SuggestionTagWindow     = 90 * 24 * time.Hour
+)
+
+// suggestible tells whether the user in candidate may be suggested to the user
+// in user: they are not friends, neither blocked the other, user did not
+// dismiss candidate and there is no pending friend request between them.
+func suggestible(user string, candidate string) string {
+	return `
+		    NOT EXISTS (
+		        SELECT 1 FROM relationships r
+		        WHERE (r.user_first_id = ` + user + ` AND r.user_second_id = ` + candidate + `)
+		        OR (r.user_first_id = ` + candidate + ` AND r.user_second_id = ` + user + `)
+		    )
+		    AND NOT EXISTS (
+		        SELECT 1 FROM user_blocks b
+		        WHERE (b.user_id = ` + user + ` AND b.target_id = ` + candidate + `)
+		        OR (b.user_id = ` + candidate + ` AND b.target_id = ` + user + `)
+		    )
+		    AND NOT EXISTS (
+		        SELECT 1 FROM friend_suggestion_dismissals d
+		        WHERE d.user_id = ` + user + ` AND d.target_id = ` + candidate + `
+		    )
+		    AND NOT EXISTS (
+		        SELECT 1 FROM friend_requests fr
+		        WHERE fr.status = 'pending'
+		        AND ((fr.sender_id = ` + user + ` AND fr.receiver_id = ` + candidate + `)
+		        OR (fr.sender_id = ` + candidate + ` AND fr.receiver_id = ` + user + `))
+		    )`
+}
+
+// RefreshSuggestions recomputes the friend suggestions of every user,
+// batchSize users at a time, and returns for how many users it did. It is run
+// periodically in the background, so that listing suggestions stays cheap even
+// for users with thousands of friends.
+func (ps *RelationshipStore) RefreshSuggestions(ctx context.Context, batchSize int) (int, error) {
+	refreshed := 0
+	lastId := 0
+	for {
+		n, next, err := ps.refreshSuggestionBatch(ctx, lastId, batchSize)
+		if err != nil {
+			return refreshed, err
+		}
+		refreshed += n
+		if next == lastId {
+			return refreshed, nil
+		}
+		lastId = next
+	}
+}
+
+// refreshSuggestionBatch replaces the suggestions of the batchSize users after
+// lastId and returns how many users there were and the id to continue after.
+func (ps *RelationshipStore) refreshSuggestionBatch(ctx context.Context, lastId int, batchSize int) (int, int, error) {
+	rows, err := ps.db.Query(ctx, "SELECT id FROM users WHERE id > $1 ORDER BY id LIMIT $2", lastId, batchSize)
+	if err != nil {
+		return 0, lastId, errors.Wrap(err, "failed to get users")
+	}
+	var userIds []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, lastId, errors.Wrap(err, "failed to scan user")
+		}
+		userIds = append(userIds, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, lastId, errors.Wrap(err, "error while iterating over rows")
+	}
+	if len(userIds) == 0 {
+		return 0, lastId, nil
+	}
+
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return 0, lastId, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM friend_suggestions WHERE user_id = ANY($1)", userIds); err != nil {
+		return 0, lastId, errors.Wrap(err, "failed to delete friend suggestions")
+	}
+
+	query := `
+		WITH batch AS (
+		    SELECT UNNEST($1::int[]) AS user_id
+		), friends AS (
+		    SELECT user_first_id AS user_id, user_second_id AS friend_id
+		    FROM relationships WHERE user_first_id = ANY($1)
+		    UNION ALL
+		    SELECT user_second_id, user_first_id
+		    FROM relationships WHERE user_second_id = ANY($1)
+		), friends_of_friends AS (
+		    SELECT user_first_id AS user_id, user_second_id AS friend_id
+		    FROM relationships WHERE user_first_id IN (SELECT friend_id FROM friends)
+		    UNION ALL
+		    SELECT user_second_id, user_first_id
+		    FROM relationships WHERE user_second_id IN (SELECT friend_id FROM friends)
+		), candidates AS (
+		    SELECT f.user_id, ff.friend_id AS suggested_id, COUNT(*) AS mutual_friends
+		    FROM friends f
+		    JOIN friends_of_friends ff ON ff.user_id = f.friend_id
+		    WHERE ff.friend_id <> f.user_id
+		    GROUP BY f.user_id, ff.friend_id
+		), tags AS (
+		    SELECT DISTINCT p.user_id, LOWER(t.tag) AS tag
+		    FROM posts p
+		    CROSS JOIN jsonb_array_elements_text(p.tags) AS t(tag)
+		    WHERE p.deleted_at IS NULL AND p.visibility = 'public' AND p.created_at > $2
+		    AND p.user_id IN (SELECT user_id FROM batch UNION SELECT suggested_id FROM candidates)
+		), shared AS (
+		    SELECT c.user_id, c.suggested_id, COUNT(*) AS shared_tags
+		    FROM candidates c
+		    JOIN tags a ON a.user_id = c.user_id
+		    JOIN tags b ON b.user_id = c.suggested_id AND b.tag = a.tag
+		    GROUP BY c.user_id, c.suggested_id
+		), ranked AS (
+		    SELECT c.user_id, c.suggested_id, c.mutual_friends, COALESCE(s.shared_tags, 0) AS shared_tags,
+		           c.mutual_friends + $3::real * LEAST(COALESCE(s.shared_tags, 0), $4::int) AS score
+		    FROM candidates c
+		    LEFT JOIN shared s ON s.user_id = c.user_id AND s.suggested_id = c.suggested_id
+		    WHERE ` + suggestible("c.user_id", "c.suggested_id") + `
+		), numbered AS (
+		    SELECT *, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY score DESC, suggested_id) AS position
+		    FROM ranked
+		)
+		INSERT INTO friend_suggestions (user_id, suggested_id, mutual_friends, shared_tags, score)
+		SELECT user_id, suggested_id, mutual_friends, shared_tags, score
+		FROM numbered
+		WHERE position <= $5
+	`
+	cutoff := time.Now().UTC().Add(-SuggestionTagWindow)
+	_, err = tx.Exec(ctx, query, userIds, cutoff, SuggestionTagWeight, SuggestionMaxSharedTags, SuggestionsPerUser)
+	if err != nil {
+		return 0, lastId, errors.Wrap(err, "failed to compute friend suggestions")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, lastId, errors.Wrap(err, "failed to commit friend suggestions")
+	}
+	return len(userIds), userIds[len(userIds)-1], nil
+}
+
+type Suggestion struct {
+	User          Friend
+	MutualFriends int
+	SharedTags    int
+}
+
+type GetSuggestionListRow struct {
+	Suggestions []*Suggestion
+	Meta        Meta
+}
+
+// GetSuggestionList lists the precomputed suggestions of userId, best first.
+// Suggestions that no longer apply, because the users became friends or one
+// blocked the other since they were computed, are left out.
+func (ps *RelationshipStore) GetSuggestionList(ctx context.Context, userId int, queryParams url.Values) (*GetSuggestionListRow, error) {
+	limit := 10
+	limitStr := queryParams.Get("limit")
+	if queryParams.Has("limit") && limitStr == "" {
+		return nil, errors.New("bad request")
+	}
+	if limitStr != "" {
+		limitx, err := strconv.Atoi(limitStr)
+		if err != nil || limitx < 0 {
+			return nil, errors.New("bad request")
+		}
+		limit = limitx
+	}
+
+	offset := 0
+	offsetStr := queryParams.Get("offset")
+	if queryParams.Has("offset") && offsetStr == "" {
+		return nil, errors.New("bad request")
+	}
+	if offsetStr != "" {
+		offsetx, err := strconv.Atoi(offsetStr)
+		if err != nil || offsetx < 0 {
+			return nil, errors.New("bad request")
+		}
+		offset = offsetx
+	}
+
+	from := `
+		FROM friend_suggestions s
+		JOIN users u ON u.id = s.suggested_id
+		WHERE s.user_id = $1 AND ` + suggestible("s.user_id", "s.suggested_id")
+	query := `
+		SELECT s.mutual_friends, s.shared_tags, u.id, u.name, u.image_url, u.friend_count, u.created_at
+		` + from + `
+		ORDER BY s.score DESC, s.suggested_id
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := ps.db.Query(ctx, query, userId, limit, offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query friend suggestions")
+	}
+	defer rows.Close()
+
+	suggestions := make([]*Suggestion, 0)
+	for rows.Next() {
+		var suggestion Suggestion
+		err := rows.Scan(
+			&suggestion.MutualFriends,
+			&suggestion.SharedTags,
+			&suggestion.User.UserId,
+			&suggestion.User.Name,
+			&suggestion.User.ImageUrl,
+			&suggestion.User.FriendCount,
+			&suggestion.User.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan friend suggestion")
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+	users := make([]*Friend, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		users = append(users, &suggestion.User)
+	}
+	if err := ps.annotateFriends(ctx, userId, users); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := ps.db.QueryRow(ctx, "SELECT COUNT(*) "+from, userId).Scan(&count); err != nil {
+		return nil, errors.Wrap(err, "failed to get total friend suggestions")
+	}
+
+	return &GetSuggestionListRow{
+		Suggestions: suggestions,
+		Meta: Meta{
+			Limit:  limit,
+			Offset: offset,
+			Total:  count,
+		},
+	}, nil
+}
+
+// DismissSuggestion stops suggesting targetId to userId, now and in later
+// refreshes.
+func (ps *RelationshipStore) DismissSuggestion(ctx context.Context, targetId int, userId int) error {
+	if targetId == userId {
+		return ErrSelfRequest
+	}
+
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	var exist bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", targetId).Scan(&exist)
+	if err != nil {
+		return errors.Wrap(err, "failed check user exist")
+	}
+	if !exist {
+		return ErrNotExist
+	}
+
+	query := "INSERT INTO friend_suggestion_dismissals (user_id, target_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	if _, err := tx.Exec(ctx, query, userId, targetId); err != nil {
+		return errors.Wrap(err, "failed to dismiss friend suggestion")
+	}
+	query = "DELETE FROM friend_suggestions WHERE user_id = $1 AND suggested_id = $2"
+	if _, err := tx.Exec(ctx, query, userId, targetId); err != nil {
+		return errors.Wrap(err, "failed to delete friend suggestion")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit friend suggestion dismissal")
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid refresh token")
+	ErrTokenReused  = errors.New("refresh token reused, session revoked")
+)
+
+type SessionStore struct {
+	db       *pgxpool.Pool
+	Validate *validator.Validate
+}
+
+func NewSessionStore(db *pgxpool.Pool, validate *validator.Validate) *SessionStore {
+	return &SessionStore{
+		db:       db,
+		Validate: validate,
+	}
+}
+
+// Create starts a session of userId that ends at expiresAt. Expiry times are
+// stored and compared in UTC, since the column has no time zone.
+func (ss *SessionStore) Create(ctx context.Context, userId int, refreshHash string, expiresAt time.Time) (*model.Session, error) {
+	expiresAt = expiresAt.UTC()
+	session := model.Session{
+		Id:        uuid.New().String(),
+		UserId:    userId,
+		ExpiresAt: expiresAt,
+	}
+
+	tx, err := ss.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	query := "INSERT INTO sessions (id, user_id, expires_at) VALUES($1,$2,$3) RETURNING created_at"
+	err = tx.QueryRow(ctx, query, session.Id, userId, expiresAt).Scan(&session.CreatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create session")
+	}
+
+	query = "INSERT INTO refresh_tokens (session_id, token_hash) VALUES($1,$2)"
+	_, err = tx.Exec(ctx, query, session.Id, refreshHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create refresh token")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to commit session")
+	}
+	return &session, nil
+}
+
+// Rotate exchanges the refresh token identified by oldHash for newHash. A token
+// that has already been exchanged is treated as stolen and the whole session is
+// revoked.
+func (ss *SessionStore) Rotate(ctx context.Context, oldHash string, newHash string) (*model.Session, error) {
+	tx, err := ss.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	var session model.Session
+	var tokenId int
+	var usedAt *time.Time
+	var expired bool
+	query := `
+		SELECT rt.id, rt.used_at, s.id, s.user_id, s.created_at, s.expires_at, s.revoked_at, s.expires_at <= $2
+		FROM refresh_tokens rt
+		JOIN sessions s ON s.id = rt.session_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE
+	`
+	err = tx.QueryRow(ctx, query, oldHash, time.Now().UTC()).Scan(
+		&tokenId,
+		&usedAt,
+		&session.Id,
+		&session.UserId,
+		&session.CreatedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+		&expired,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		return nil, errors.Wrap(err, "failed to get refresh token")
+	}
+
+	if session.RevokedAt != nil || expired {
+		return nil, ErrInvalidToken
+	}
+
+	if usedAt != nil {
+		_, err = tx.Exec(ctx, "UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1", session.Id)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to revoke session")
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, errors.Wrap(err, "failed to commit session")
+		}
+		return nil, ErrTokenReused
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1", tokenId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to use refresh token")
+	}
+
+	query = "INSERT INTO refresh_tokens (session_id, token_hash) VALUES($1,$2)"
+	_, err = tx.Exec(ctx, query, session.Id, newHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create refresh token")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to commit session")
+	}
+	return &session, nil
+}
+
+func (ss *SessionStore) Revoke(ctx context.Context, sessionId string, userId int) error {
+	query := `
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+	_, err := ss.db.Exec(ctx, query, sessionId, userId)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke session")
+	}
+	return nil
+}
+
+func (ss *SessionStore) IsActive(ctx context.Context, sessionId string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+		    SELECT 1
+		    FROM sessions
+		    WHERE id = $1
+		    AND revoked_at IS NULL
+		    AND expires_at > $2
+		)
+	`
+	var active bool
+	err := ss.db.QueryRow(ctx, query, sessionId, time.Now().UTC()).Scan(&active)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check session")
+	}
+	return active, nil
+}
+
+// RevokeAll signs userId out everywhere, for example after a password reset.
+func (ss *SessionStore) RevokeAll(ctx context.Context, userId int) error {
+	query := `
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	_, err := ss.db.Exec(ctx, query, userId)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke sessions")
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package user
+
+import (
+	"context"
+	"crypto/subtle"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/service/auth"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	CodeLifetime = 10 * time.Minute
+	// A credential gets at most one code per resendInterval and maxCodesPerHour
+	// codes per hour, and a code survives maxCodeAttempts wrong guesses.
+	resendInterval  = time.Minute
+	maxCodesPerHour = 5
+	maxCodeAttempts = 5
+)
+
+var (
+	ErrCredentialNotFound = errors.New("credential not found")
+	ErrAlreadyVerified    = errors.New("credential already verified")
+	ErrInvalidCode        = errors.New("invalid or expired code")
+	ErrTooManyCodes       = errors.New("too many codes requested, try again later")
+)
+
+const credentialColumns = "SELECT id, credential_type, credential_value, user_id, verified_at FROM user_credentials"
+
+func scanCredential(row pgx.Row) (*model.Credential, error) {
+	var credential model.Credential
+	err := row.Scan(
+		&credential.Id,
+		&credential.CredentialType,
+		&credential.CredentialValue,
+		&credential.UserId,
+		&credential.VerifiedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCredentialNotFound
+		}
+		return nil, errors.Wrap(err, "failed to get credential")
+	}
+	return &credential, nil
+}
+
+func (us *UserStore) GetCredential(ctx context.Context, credentialType string, credentialValue string) (*model.Credential, error) {
+	query := credentialColumns + " WHERE credential_type = $1 AND credential_value = $2"
+	return scanCredential(us.db.QueryRow(ctx, query, credentialType, credentialValue))
+}
+
+func (us *UserStore) GetUserCredential(ctx context.Context, userId int, credentialType string) (*model.Credential, error) {
+	query := credentialColumns + " WHERE user_id = $1 AND credential_type = $2"
+	return scanCredential(us.db.QueryRow(ctx, query, userId, credentialType))
+}
+
+// IssueCode creates a one-time code for credentialId and returns it in clear so
+// that it can be sent. Earlier codes for the same purpose stop working.
+func (us *UserStore) IssueCode(ctx context.Context, credentialId int, purpose string) (string, error) {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the credential serializes concurrent requests for codes.
+	_, err = tx.Exec(ctx, "SELECT 1 FROM user_credentials WHERE id = $1 FOR UPDATE", credentialId)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to lock credential")
+	}
+
+	var issued int
+	var lastIssued *time.Time
+	query := `
+		SELECT COUNT(*), MAX(created_at)
+		FROM one_time_codes
+		WHERE credential_id = $1 AND purpose = $2 AND created_at > $3
+	`
+	now := time.Now().UTC()
+	err = tx.QueryRow(ctx, query, credentialId, purpose, now.Add(-time.Hour)).Scan(&issued, &lastIssued)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to count codes")
+	}
+	if issued >= maxCodesPerHour || (lastIssued != nil && now.Sub(*lastIssued) < resendInterval) {
+		return "", ErrTooManyCodes
+	}
+
+	query = `
+		UPDATE one_time_codes SET expires_at = $3
+		WHERE credential_id = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+	`
+	if _, err := tx.Exec(ctx, query, credentialId, purpose, now); err != nil {
+		return "", errors.Wrap(err, "failed to expire codes")
+	}
+
+	code, codeHash, err := auth.GenerateCode()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate code")
+	}
+	query = `
+		INSERT INTO one_time_codes (credential_id, purpose, code_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := tx.Exec(ctx, query, credentialId, purpose, codeHash, now.Add(CodeLifetime), now); err != nil {
+		return "", errors.Wrap(err, "failed to create code")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", errors.Wrap(err, "failed to commit code")
+	}
+	return code, nil
+}
+
+// consumeCode checks code against the live code of credentialId and marks it
+// used. A wrong guess is recorded in tx, so callers have to commit tx even when
+// ErrInvalidCode is returned.
+func consumeCode(ctx context.Context, tx pgx.Tx, credentialId int, purpose string, code string) error {
+	var id, attempts int
+	var codeHash string
+	query := `
+		SELECT id, code_hash, attempts
+		FROM one_time_codes
+		WHERE credential_id = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+		ORDER BY created_at DESC
+		LIMIT 1
+		FOR UPDATE
+	`
+	err := tx.QueryRow(ctx, query, credentialId, purpose, time.Now().UTC()).Scan(&id, &codeHash, &attempts)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidCode
+		}
+		return errors.Wrap(err, "failed to get code")
+	}
+	if attempts >= maxCodeAttempts {
+		return ErrInvalidCode
+	}
+
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(auth.HashCode(code))) != 1 {
+		_, err := tx.Exec(ctx, "UPDATE one_time_codes SET attempts = attempts + 1 WHERE id = $1", id)
+		if err != nil {
+			return errors.Wrap(err, "failed to record attempt")
+		}
+		return ErrInvalidCode
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE one_time_codes SET used_at = CURRENT_TIMESTAMP WHERE id = $1", id); err != nil {
+		return errors.Wrap(err, "failed to use code")
+	}
+	return nil
+}
+
+// redeemCode runs apply once code has been accepted. Both happen in one
+// transaction so that a code is never spent without its effect.
+func (us *UserStore) redeemCode(ctx context.Context, credentialId int, purpose string, code string, apply func(tx pgx.Tx) error) error {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	err = consumeCode(ctx, tx, credentialId, purpose, code)
+	if errors.Is(err, ErrInvalidCode) {
+		if err := tx.Commit(ctx); err != nil {
+			return errors.Wrap(err, "failed to commit code attempt")
+		}
+		return ErrInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := apply(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit code")
+	}
+	return nil
+}
+
+func markVerified(ctx context.Context, tx pgx.Tx, credentialId int) error {
+	query := "UPDATE user_credentials SET verified_at = COALESCE(verified_at, CURRENT_TIMESTAMP) WHERE id = $1"
+	if _, err := tx.Exec(ctx, query, credentialId); err != nil {
+		return errors.Wrap(err, "failed to verify credential")
+	}
+	return nil
+}
+
+// ResetPassword replaces the password of the owner of credential with
+// passwordHash. Receiving the code also proves the credential, so it is marked
+// verified as well.
+func (us *UserStore) ResetPassword(ctx context.Context, credential *model.Credential, code string, passwordHash string) error {
+	return us.redeemCode(ctx, credential.Id, model.CodePasswordReset, code, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE users SET password = $1 WHERE id = $2", passwordHash, credential.UserId)
+		if err != nil {
+			return errors.Wrap(err, "failed to update password")
+		}
+		return markVerified(ctx, tx, credential.Id)
+	})
+}
+
+func (us *UserStore) VerifyCredential(ctx context.Context, credential *model.Credential, code string) error {
+	if credential.VerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+	return us.redeemCode(ctx, credential.Id, model.CodeVerifyCredential, code, func(tx pgx.Tx) error {
+		return markVerified(ctx, tx, credential.Id)
+	})
+}
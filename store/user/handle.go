@@ -0,0 +1,160 @@
+package user
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/store/relationship"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+)
+
+// HandleCooldown is how long users have to keep a handle before they may pick
+// another one, so that handles cannot be grabbed and released on a whim.
+const HandleCooldown = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidHandle  = errors.New("handle must be 3 to 30 letters, digits or underscores and not only digits")
+	ErrReservedHandle = errors.New("handle is reserved")
+	ErrHandleTaken    = errors.New("handle already taken")
+	ErrHandleCooldown = errors.New("handle was changed recently, try again later")
+)
+
+var (
+	handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+	digitsPattern = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// reservedHandles could be mistaken for the service itself or collide with
+// routes that take a handle.
+var reservedHandles = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"help":          true,
+	"login":         true,
+	"logout":        true,
+	"me":            true,
+	"moderator":     true,
+	"null":          true,
+	"register":      true,
+	"root":          true,
+	"search":        true,
+	"settings":      true,
+	"staff":         true,
+	"support":       true,
+	"system":        true,
+	"undefined":     true,
+}
+
+// CheckHandle tells whether handle may be picked by anyone. Handles of digits
+// only are refused so that they never read as user ids.
+func CheckHandle(handle string) error {
+	if !handlePattern.MatchString(handle) || digitsPattern.MatchString(handle) {
+		return ErrInvalidHandle
+	}
+	if reservedHandles[strings.ToLower(handle)] {
+		return ErrReservedHandle
+	}
+	return nil
+}
+
+// GetIdByHandle finds a user by handle, ignoring case.
+func (us *UserStore) GetIdByHandle(ctx context.Context, handle string) (int, error) {
+	var id int
+	err := us.db.QueryRow(ctx, "SELECT id FROM users WHERE LOWER(handle) = LOWER($1)", handle).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+		return 0, errors.Wrap(err, "failed to get user by handle")
+	}
+	return id, nil
+}
+
+// setHandle gives userId a new handle. Changing only the case of the current
+// handle is always allowed, any other change waits for HandleCooldown.
+func setHandle(ctx context.Context, tx pgx.Tx, userId int, handle string) error {
+	if err := CheckHandle(handle); err != nil {
+		return err
+	}
+
+	var current *string
+	var changedAt *time.Time
+	query := "SELECT handle, handle_changed_at FROM users WHERE id = $1 FOR UPDATE"
+	if err := tx.QueryRow(ctx, query, userId).Scan(&current, &changedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return errors.Wrap(err, "failed to get handle")
+	}
+	if current != nil && *current == handle {
+		return nil
+	}
+
+	// A case change keeps handle_changed_at, so it does not restart the cooldown.
+	var newChangedAt *time.Time
+	if current == nil || !strings.EqualFold(*current, handle) {
+		now := time.Now().UTC()
+		if current != nil && changedAt != nil && now.Sub(*changedAt) < HandleCooldown {
+			return ErrHandleCooldown
+		}
+		newChangedAt = &now
+	}
+
+	query = "UPDATE users SET handle = $1, handle_changed_at = COALESCE($2, handle_changed_at) WHERE id = $3"
+	if _, err := tx.Exec(ctx, query, handle, newChangedAt, userId); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrHandleTaken
+		}
+		return errors.Wrap(err, "failed to update handle")
+	}
+	return nil
+}
+
+// UpdateUser applies update to the profile of userId.
+func (us *UserStore) UpdateUser(ctx context.Context, update *model.UserUpdate, userId int) error {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if update.Handle != nil {
+		if err := setHandle(ctx, tx, userId, *update.Handle); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE users
+		SET name = COALESCE($1, name), image_url = COALESCE($2, image_url), bio = COALESCE($3, bio),
+		    website = COALESCE($4, website), location = COALESCE($5, location),
+		    discoverable_by_email = COALESCE($6, discoverable_by_email),
+		    discoverable_by_phone = COALESCE($7, discoverable_by_phone),
+		    followers_need_approval = COALESCE($8, followers_need_approval)
+		WHERE id = $9
+	`
+	_, err = tx.Exec(ctx, query, update.Name, update.ImageUrl, update.Bio, update.Website, update.Location,
+		update.DiscoverableByEmail, update.DiscoverableByPhone, update.FollowersNeedApproval, userId)
+	if err != nil {
+		return errors.Wrap(err, "failed to update users")
+	}
+
+	// Nobody is left waiting once followers no longer need approval.
+	if update.FollowersNeedApproval != nil && !*update.FollowersNeedApproval {
+		if err := relationship.AcceptPendingFollowers(ctx, tx, userId); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit user")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/store/relation"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// GetProfile returns the public profile of id as seen by viewerId, with their
+// relation to it. Users who blocked each other do not see each other's profile.
+func (us *UserStore) GetProfile(ctx context.Context, id int, viewerId int) (*model.UserProfile, error) {
+	query := `
+		SELECT u.id, u.name, u.image_url, u.friend_count, u.created_at,
+		       u.handle, u.bio, u.website, u.location, u.follower_count, u.following_count,
+		       COALESCE((SELECT f.status FROM follows f WHERE f.follower_id = $2 AND f.followee_id = u.id), '')
+		FROM users u
+		WHERE u.id = $1
+		AND NOT EXISTS (
+		    SELECT 1 FROM user_blocks b
+		    WHERE (b.user_id = $1 AND b.target_id = $2) OR (b.user_id = $2 AND b.target_id = $1)
+		)
+	`
+	var profile model.UserProfile
+	var imageUrl sql.NullString
+	err := us.db.QueryRow(ctx, query, id, viewerId).Scan(
+		&profile.UserId,
+		&profile.Name,
+		&imageUrl,
+		&profile.FriendCount,
+		&profile.CreatedAt,
+		&profile.Handle,
+		&profile.Bio,
+		&profile.Website,
+		&profile.Location,
+		&profile.FollowerCount,
+		&profile.FollowingCount,
+		&profile.Follow,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, errors.Wrap(err, "failed to get profile")
+	}
+	profile.ImageURL = imageUrl.String
+	if err := relation.Annotate(ctx, us.db, viewerId, []*model.CreatorValid{&profile.CreatorValid}); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// GetAccount returns the account of userId with the credentials linked to it.
+func (us *UserStore) GetAccount(ctx context.Context, userId int) (*model.Account, error) {
+	user, err := us.GetById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	account := model.Account{
+		CreatorValid: model.CreatorValid{
+			UserId:      user.Id,
+			Name:        user.Name,
+			ImageURL:    user.ImageUrl,
+			FriendCount: user.FriendCount,
+			CreatedAt:   user.CreatedAt,
+			Relation:    model.Relation{Relationship: model.RelationshipSelf},
+		},
+		Profile:               user.Profile,
+		Discovery:             user.Discovery,
+		FollowCounts:          user.FollowCounts,
+		FollowersNeedApproval: user.FollowersNeedApproval,
+		HandleChangedAt:       user.HandleChangedAt,
+		Credentials:           make([]model.AccountCredential, 0),
+	}
+
+	query := credentialColumns + " WHERE user_id = $1 ORDER BY id"
+	rows, err := us.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get credentials")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		credential, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		account.Credentials = append(account.Credentials, model.AccountCredential{
+			CredentialType:  credential.CredentialType,
+			CredentialValue: credential.CredentialValue,
+			Verified:        credential.VerifiedAt != nil,
+			VerifiedAt:      credential.VerifiedAt,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+
+	account.TwoFactorEnabled, err = us.TwoFactorEnabled(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
@@ -0,0 +1,156 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/billymosis/socialmedia-app/model"
+	"github.com/billymosis/socialmedia-app/store/relation"
+	"github.com/pkg/errors"
+)
+
+// MaxSearchLimit caps how many users one page of search results holds.
+const MaxSearchLimit = 50
+
+var (
+	ErrEmptySearch = errors.New("search query is required")
+	ErrInvalidPage = errors.New("bad request")
+)
+
+// SearchResult is one page of users found by SearchUsers.
+type SearchResult struct {
+	Users []model.UserProfile
+	Meta  model.Meta
+}
+
+// SearchUsers finds the users whose name or handle looks like the q parameter
+// of queryParams, and the users who let themselves be found by the verified
+// email address or phone number q is equal to. Users who blocked viewerId, or
+// were blocked by them, are never found. Exact matches come first, then users
+// with more mutual friends, then the closer matches.
+func (us *UserStore) SearchUsers(ctx context.Context, viewerId int, queryParams url.Values) (*SearchResult, error) {
+	search := strings.TrimSpace(queryParams.Get("q"))
+	if search == "" {
+		return nil, ErrEmptySearch
+	}
+	// Handles are written with an @ in front, names never start with one.
+	term := strings.ToLower(strings.TrimPrefix(search, "@"))
+
+	limit := 10
+	limitStr := queryParams.Get("limit")
+	if queryParams.Has("limit") && limitStr == "" {
+		return nil, ErrInvalidPage
+	}
+	if limitStr != "" {
+		limitx, err := strconv.Atoi(limitStr)
+		if err != nil || limitx < 0 {
+			return nil, ErrInvalidPage
+		}
+		limit = min(limitx, MaxSearchLimit)
+	}
+
+	offset := 0
+	offsetStr := queryParams.Get("offset")
+	if queryParams.Has("offset") && offsetStr == "" {
+		return nil, ErrInvalidPage
+	}
+	if offsetStr != "" {
+		offsetx, err := strconv.Atoi(offsetStr)
+		if err != nil || offsetx < 0 {
+			return nil, ErrInvalidPage
+		}
+		offset = offsetx
+	}
+
+	// The mutual friends only order the users here. The count shown comes with
+	// the rest of their relation from relation.Annotate.
+	query := `
+		WITH viewer_friends AS (
+		    SELECT CASE WHEN user_first_id = $1 THEN user_second_id ELSE user_first_id END AS friend_id
+		    FROM relationships
+		    WHERE user_first_id = $1 OR user_second_id = $1
+		), credential_matches AS (
+		    SELECT c.user_id
+		    FROM user_credentials c
+		    JOIN users u ON u.id = c.user_id
+		    WHERE c.verified_at IS NOT NULL
+		    AND (
+		        (c.credential_type = 'email' AND u.discoverable_by_email AND LOWER(c.credential_value) = LOWER($3))
+		        OR (c.credential_type = 'phone' AND u.discoverable_by_phone AND c.credential_value = $3)
+		    )
+		), found AS (
+		    SELECT u.id, u.name, u.image_url, u.friend_count, u.created_at,
+		           u.handle, u.bio, u.website, u.location,
+		           u.id IN (SELECT user_id FROM credential_matches) OR COALESCE(LOWER(u.handle) = $2, FALSE) AS exact,
+		           GREATEST(word_similarity($2, LOWER(u.name)), COALESCE(word_similarity($2, LOWER(u.handle)), 0)) AS score
+		    FROM users u
+		    WHERE u.id <> $1
+		    AND ($2 <% LOWER(u.name) OR $2 <% LOWER(u.handle) OR u.id IN (SELECT user_id FROM credential_matches))
+		    AND NOT EXISTS (
+		        SELECT 1 FROM user_blocks b
+		        WHERE (b.user_id = u.id AND b.target_id = $1) OR (b.user_id = $1 AND b.target_id = u.id)
+		    )
+		)
+		SELECT f.id, f.name, f.image_url, f.friend_count, f.created_at,
+		       f.handle, f.bio, f.website, f.location,
+		       COUNT(*) OVER ()
+		FROM found f
+		ORDER BY f.exact DESC,
+		         (
+		             SELECT COUNT(*) FROM relationships r
+		             JOIN viewer_friends vf ON vf.friend_id = CASE WHEN r.user_first_id = f.id THEN r.user_second_id ELSE r.user_first_id END
+		             WHERE r.user_first_id = f.id OR r.user_second_id = f.id
+		         ) DESC,
+		         f.score DESC, f.id
+		LIMIT $4 OFFSET $5
+	`
+	rows, err := us.db.Query(ctx, query, viewerId, term, search, limit, offset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search users")
+	}
+	defer rows.Close()
+
+	result := SearchResult{
+		Users: make([]model.UserProfile, 0),
+		Meta: model.Meta{
+			Limit:  limit,
+			Offset: offset,
+		},
+	}
+	for rows.Next() {
+		var profile model.UserProfile
+		var imageUrl sql.NullString
+		err := rows.Scan(
+			&profile.UserId,
+			&profile.Name,
+			&imageUrl,
+			&profile.FriendCount,
+			&profile.CreatedAt,
+			&profile.Handle,
+			&profile.Bio,
+			&profile.Website,
+			&profile.Location,
+			&result.Meta.Total,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan user")
+		}
+		profile.ImageURL = imageUrl.String
+		result.Users = append(result.Users, profile)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error while iterating over rows")
+	}
+
+	creators := make([]*model.CreatorValid, 0, len(result.Users))
+	for i := range result.Users {
+		creators = append(creators, &result.Users[i].CreatorValid)
+	}
+	if err := relation.Annotate(ctx, us.db, viewerId, creators); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,248 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/billymosis/socialmedia-app/service/auth"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	ChallengeLifetime = 5 * time.Minute
+	// maxChallengeAttempts bounds how many second factors may be guessed with
+	// one password login.
+	maxChallengeAttempts = 5
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication not enrolled")
+	ErrInvalidChallenge     = errors.New("invalid or expired login challenge")
+)
+
+func (us *UserStore) TwoFactorEnabled(ctx context.Context, userId int) (bool, error) {
+	query := "SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)"
+	var enabled bool
+	if err := us.db.QueryRow(ctx, query, userId).Scan(&enabled); err != nil {
+		return false, errors.Wrap(err, "failed to check two-factor")
+	}
+	return enabled, nil
+}
+
+// EnrollTOTP stores secret as the pending TOTP secret of userId, replacing any
+// earlier enrollment that was never confirmed. It returns the name of the user
+// to label the secret with in authenticator apps.
+func (us *UserStore) EnrollTOTP(ctx context.Context, userId int, secret string) (string, error) {
+	enabled, err := us.TwoFactorEnabled(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		return "", ErrTwoFactorEnabled
+	}
+
+	var name string
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		SELECT id, $2 FROM users WHERE id = $1
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.enabled_at IS NULL
+		RETURNING (SELECT name FROM users WHERE id = $1)
+	`
+	err = us.db.QueryRow(ctx, query, userId, secret).Scan(&name)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrTwoFactorEnabled
+		}
+		return "", errors.Wrap(err, "failed to enroll two-factor")
+	}
+	return name, nil
+}
+
+// checkTOTP validates code against the TOTP secret of userId and records the
+// step it was generated for. With pending set it checks an enrollment that has
+// not been confirmed yet.
+func checkTOTP(ctx context.Context, tx pgx.Tx, userId int, code string, pending bool) error {
+	var secret string
+	var lastStep int64
+	var enabledAt *time.Time
+	query := "SELECT secret, last_step, enabled_at FROM user_totp WHERE user_id = $1 FOR UPDATE"
+	err := tx.QueryRow(ctx, query, userId).Scan(&secret, &lastStep, &enabledAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTwoFactorNotEnrolled
+		}
+		return errors.Wrap(err, "failed to get two-factor secret")
+	}
+	if pending && enabledAt != nil {
+		return ErrTwoFactorEnabled
+	}
+	if !pending && enabledAt == nil {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, time.Now(), lastStep)
+	if !ok {
+		return ErrInvalidCode
+	}
+	if _, err := tx.Exec(ctx, "UPDATE user_totp SET last_step = $1 WHERE user_id = $2", step, userId); err != nil {
+		return errors.Wrap(err, "failed to update two-factor step")
+	}
+	return nil
+}
+
+// useRecoveryCode spends one of the recovery codes of userId.
+func useRecoveryCode(ctx context.Context, tx pgx.Tx, userId int, code string) error {
+	query := `
+		UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE id = (
+		    SELECT id FROM recovery_codes
+		    WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+		    LIMIT 1
+		    FOR UPDATE
+		)
+	`
+	tag, err := tx.Exec(ctx, query, userId, auth.HashRecoveryCode(code))
+	if err != nil {
+		return errors.Wrap(err, "failed to use recovery code")
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code.
+func checkSecondFactor(ctx context.Context, tx pgx.Tx, userId int, code string) error {
+	err := checkTOTP(ctx, tx, userId, code, false)
+	if errors.Is(err, ErrInvalidCode) {
+		return useRecoveryCode(ctx, tx, userId, code)
+	}
+	return err
+}
+
+// ConfirmTOTP turns two-factor authentication on once the user proved their
+// app generates valid codes, and replaces their recovery codes with
+// recoveryHashes.
+func (us *UserStore) ConfirmTOTP(ctx context.Context, userId int, code string, recoveryHashes []string) error {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkTOTP(ctx, tx, userId, code, true); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE user_totp SET enabled_at = CURRENT_TIMESTAMP WHERE user_id = $1", userId); err != nil {
+		return errors.Wrap(err, "failed to enable two-factor")
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userId); err != nil {
+		return errors.Wrap(err, "failed to delete recovery codes")
+	}
+	query := `
+		INSERT INTO recovery_codes (user_id, code_hash)
+		SELECT $1, UNNEST($2::text[])
+	`
+	if _, err := tx.Exec(ctx, query, userId, recoveryHashes); err != nil {
+		return errors.Wrap(err, "failed to create recovery codes")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit two-factor")
+	}
+	return nil
+}
+
+// DisableTOTP turns two-factor authentication off after checking a second
+// factor, and drops the remaining recovery codes.
+func (us *UserStore) DisableTOTP(ctx context.Context, userId int, code string) error {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkSecondFactor(ctx, tx, userId, code); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM user_totp WHERE user_id = $1", userId); err != nil {
+		return errors.Wrap(err, "failed to disable two-factor")
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userId); err != nil {
+		return errors.Wrap(err, "failed to delete recovery codes")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit two-factor")
+	}
+	return nil
+}
+
+// CreateLoginChallenge records that userId passed the password check. Only the
+// hash of the challenge token handed to the client is stored.
+func (us *UserStore) CreateLoginChallenge(ctx context.Context, userId int, tokenHash string) (time.Time, error) {
+	expiresAt := time.Now().UTC().Add(ChallengeLifetime)
+	query := "INSERT INTO login_challenges (user_id, token_hash, expires_at) VALUES ($1, $2, $3)"
+	if _, err := us.db.Exec(ctx, query, userId, tokenHash, expiresAt); err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to create login challenge")
+	}
+	return expiresAt, nil
+}
+
+// CompleteLoginChallenge exchanges a challenge and a second factor for the id
+// of the user to sign in. Wrong codes count against the challenge.
+func (us *UserStore) CompleteLoginChallenge(ctx context.Context, tokenHash string, code string) (int, error) {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	var id, userId, attempts int
+	var expiresAt time.Time
+	var usedAt *time.Time
+	query := `
+		SELECT id, user_id, attempts, expires_at, used_at
+		FROM login_challenges
+		WHERE token_hash = $1
+		FOR UPDATE
+	`
+	err = tx.QueryRow(ctx, query, tokenHash).Scan(&id, &userId, &attempts, &expiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidChallenge
+		}
+		return 0, errors.Wrap(err, "failed to get login challenge")
+	}
+	if usedAt != nil || attempts >= maxChallengeAttempts || time.Now().UTC().After(expiresAt) {
+		return 0, ErrInvalidChallenge
+	}
+
+	err = checkSecondFactor(ctx, tx, userId, code)
+	if errors.Is(err, ErrInvalidCode) {
+		_, err := tx.Exec(ctx, "UPDATE login_challenges SET attempts = attempts + 1 WHERE id = $1", id)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to record attempt")
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return 0, errors.Wrap(err, "failed to commit attempt")
+		}
+		return 0, ErrInvalidCode
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE login_challenges SET used_at = CURRENT_TIMESTAMP WHERE id = $1", id); err != nil {
+		return 0, errors.Wrap(err, "failed to use login challenge")
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, errors.Wrap(err, "failed to commit login challenge")
+	}
+	return userId, nil
+}
@@ -2,13 +2,17 @@ package user
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/billymosis/socialmedia-app/model"
 	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
 type UserStore struct {
 	db       *pgxpool.Pool
 	Validate *validator.Validate
@@ -21,19 +25,42 @@ func NewUserStore(db *pgxpool.Pool, validate *validator.Validate) *UserStore {
 	}
 }
 
-func (us *UserStore) GetById(ctx context.Context, id uint) (*model.User, error) {
+func (us *UserStore) GetById(ctx context.Context, id int) (*model.User, error) {
 	var user model.User
-	query := "SELECT * FROM users WHERE id = $1 LIMIT 1"
+	var imageUrl sql.NullString
+	query := `
+		SELECT id, name, password, image_url, created_at, friend_count,
+		       handle, bio, website, location, handle_changed_at,
+		       discoverable_by_email, discoverable_by_phone,
+		       follower_count, following_count, followers_need_approval
+		FROM users
+		WHERE id = $1
+	`
 	err := us.db.QueryRow(ctx, query, id).Scan(
 		&user.Id,
 		&user.Name,
 		&user.Password,
-		&user.ImageUrl,
+		&imageUrl,
 		&user.CreatedAt,
+		&user.FriendCount,
+		&user.Handle,
+		&user.Bio,
+		&user.Website,
+		&user.Location,
+		&user.HandleChangedAt,
+		&user.Discovery.ByEmail,
+		&user.Discovery.ByPhone,
+		&user.FollowerCount,
+		&user.FollowingCount,
+		&user.FollowersNeedApproval,
 	)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
 		return nil, errors.Wrap(err, "failed to get user by ID")
 	}
+	user.ImageUrl = imageUrl.String
 	return &user, nil
 }
 
@@ -141,14 +168,3 @@ func (us *UserStore) UpdateUserPhone(ctx context.Context, phone string, userId i
 	}
 	return nil
 }
-
-func (us *UserStore) UpdateUser(ctx context.Context, image string, name string, userId int) error {
-	query := `
-	UPDATE users SET name = $1, image_url = $2 WHERE id = $3 
-	`
-	_, err := us.db.Exec(ctx, query, name, image, userId)
-	if err != nil {
-		return errors.Wrap(err, "failed to update users")
-	}
-	return nil
-}